@@ -0,0 +1,118 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/urfave/cli/v2"
+)
+
+// flagsFirst moves a command's flags in front of its positional arguments.
+// urfave/cli stops parsing flags at the first argument, so without this
+// 'lockbox secret encrypt in -o out --yes' would treat -o and --yes as
+// arguments. Only flags the command defines are moved, and nothing after
+// "--" is touched.
+func flagsFirst(app *cli.App, args []string) []string {
+	if len(args) < 2 {
+		return args
+	}
+
+	commands := app.Commands
+	flags := app.Flags
+	i := 1
+	for i < len(args) {
+		arg := args[i]
+		if arg == "--" {
+			return args
+		}
+
+		if isFlag(arg) {
+			i++
+			if takesValue(flags, arg) {
+				i++
+			}
+			continue
+		}
+
+		cmd := findCommand(commands, arg)
+		if cmd == nil {
+			break
+		}
+		if cmd.SkipFlagParsing {
+			return args
+		}
+
+		commands = cmd.Subcommands
+		flags = cmd.Flags
+		i++
+	}
+
+	var moved, positional []string
+	rest := args[i:]
+	for j := 0; j < len(rest); j++ {
+		arg := rest[j]
+		if arg == "--" {
+			positional = append(positional, rest[j:]...)
+			break
+		}
+
+		if !isFlag(arg) || lookupFlag(flags, arg) == nil {
+			positional = append(positional, arg)
+			continue
+		}
+
+		moved = append(moved, arg)
+		if takesValue(flags, arg) && j+1 < len(rest) {
+			j++
+			moved = append(moved, rest[j])
+		}
+	}
+
+	reordered := append([]string(nil), args[:i]...)
+	reordered = append(reordered, moved...)
+	return append(reordered, positional...)
+}
+
+// isFlag reports whether arg looks like a flag. A lone "-" is an argument.
+func isFlag(arg string) bool {
+	return len(arg) > 1 && strings.HasPrefix(arg, "-")
+}
+
+// flagName returns the name of a flag argument without dashes or a value
+func flagName(arg string) string {
+	name := strings.TrimLeft(arg, "-")
+	if before, _, found := strings.Cut(name, "="); found {
+		return before
+	}
+	return name
+}
+
+func lookupFlag(flags []cli.Flag, arg string) cli.Flag {
+	name := flagName(arg)
+	for _, flag := range flags {
+		for _, flagName := range flag.Names() {
+			if flagName == name {
+				return flag
+			}
+		}
+	}
+	return nil
+}
+
+// takesValue reports whether the flag in arg consumes the next argument
+func takesValue(flags []cli.Flag, arg string) bool {
+	if strings.Contains(arg, "=") {
+		return false
+	}
+
+	flag, ok := lookupFlag(flags, arg).(cli.DocGenerationFlag)
+	return ok && flag.TakesValue()
+}
+
+func findCommand(commands []*cli.Command, name string) *cli.Command {
+	for _, cmd := range commands {
+		if cmd.HasName(name) {
+			return cmd
+		}
+	}
+	return nil
+}
@@ -6,11 +6,19 @@ import (
 	"path/filepath"
 
 	"github.com/urfave/cli/v2"
+	"github.com/yourusername/lockbox/internal/crypto"
 	"github.com/yourusername/lockbox/internal/git"
+	"github.com/yourusername/lockbox/internal/output"
+	"github.com/yourusername/lockbox/internal/prompt"
 	"github.com/yourusername/lockbox/internal/version"
 	"github.com/yourusername/lockbox/internal/commands/team"
 	"github.com/yourusername/lockbox/internal/commands/key"
 	"github.com/yourusername/lockbox/internal/commands/secret"
+	"github.com/yourusername/lockbox/internal/commands/status"
+	"github.com/yourusername/lockbox/internal/commands/exec"
+	"github.com/yourusername/lockbox/internal/commands/gitfilter"
+	"github.com/yourusername/lockbox/internal/commands/textconv"
+	"github.com/yourusername/lockbox/internal/commands/hooks"
 )
 
 func main() {
@@ -18,10 +26,18 @@ func main() {
 		Name:    "lockbox",
 		Usage:   "Secure team secret management",
 		Version: version.Version,
+		Flags:   []cli.Flag{repoFlag(), formatFlag(), unlockFileFlag()},
+		Before:  setGlobals,
 		Commands: []*cli.Command{
 			{
 				Name:  "init",
 				Usage: "Initialize lockbox in the current git repository",
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:  "armor",
+						Usage: "Make 'secret encrypt' write ASCII-armored ciphertext by default (--armor=false turns it off)",
+					},
+				},
 				Action: func(c *cli.Context) error {
 					gitRoot, err := git.FindRoot()
 					if err != nil {
@@ -33,18 +49,131 @@ func main() {
 						return fmt.Errorf("failed to create lockbox directory: %w", err)
 					}
 
-					fmt.Printf("Created Lockbox directory at '%s'\n", lockboxDir)
+					output.Printf("Created Lockbox directory at '%s'\n", lockboxDir)
+
+					if c.IsSet("armor") {
+						km, err := crypto.NewKeyManager()
+						if err != nil {
+							return err
+						}
+						km.SetLocalDir(lockboxDir)
+
+						config, err := km.LoadConfig()
+						if err != nil {
+							return err
+						}
+						config.Armor = c.Bool("armor")
+						if err := km.SaveConfig(config); err != nil {
+							return err
+						}
+
+						if config.Armor {
+							output.Infof("Secrets will be encrypted with ASCII armor by default")
+						} else {
+							output.Infof("Secrets will be encrypted as binary by default")
+						}
+					}
 					return nil
 				},
 			},
 			key.Command(),
 			team.Command(),
 			secret.Command(),
+			status.Command(),
+			exec.Command(),
+			gitfilter.Command(),
+			textconv.Command(),
+			hooks.Command(),
 		},
 	}
 
-	if err := app.Run(os.Args); err != nil {
+	addGlobalFlags(app.Commands)
+
+	if err := app.Run(flagsFirst(app, os.Args)); err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 			os.Exit(1)
 	}
-} 
\ No newline at end of file
+}
+
+func repoFlag() cli.Flag {
+	return &cli.StringFlag{
+		Name:    "repo",
+		Usage:   "Use `DIR` as the repository root instead of finding it with git",
+		EnvVars: []string{"LOCKBOX_DIR"},
+	}
+}
+
+func formatFlag() cli.Flag {
+	return &cli.StringFlag{
+		Name:  "output",
+		Usage: "Print results as `FORMAT`: json, yaml or text",
+		Value: "text",
+	}
+}
+
+func unlockFileFlag() cli.Flag {
+	return &cli.StringFlag{
+		Name:    "unlock-passphrase-file",
+		Usage:   "Read the passphrase that unlocks protected keys from `FILE` (- for stdin) instead of asking",
+		EnvVars: []string{prompt.UnlockFileEnv},
+	}
+}
+
+func setGlobals(c *cli.Context) error {
+	if dir := c.String("repo"); dir != "" {
+		if err := git.SetRoot(dir); err != nil {
+			return err
+		}
+	}
+	if path := c.String("unlock-passphrase-file"); path != "" {
+		prompt.SetUnlockFile(path)
+	}
+	return output.SetFormat(c.String("output"))
+}
+
+// addGlobalFlags accepts --repo, --output and --unlock-passphrase-file on every
+// command as well, so they work after the command name too. Commands with their own --output, such as
+// 'secret encrypt', only take the format before the command name.
+func addGlobalFlags(commands []*cli.Command) {
+	for _, cmd := range commands {
+		ownOutput := hasFlag(cmd, "output")
+		cmd.Flags = append(cmd.Flags, repoFlag(), unlockFileFlag())
+		if !ownOutput {
+			cmd.Flags = append(cmd.Flags, formatFlag())
+		}
+
+		before := cmd.Before
+		cmd.Before = func(c *cli.Context) error {
+			if c.IsSet("repo") {
+				if err := git.SetRoot(c.String("repo")); err != nil {
+					return err
+				}
+			}
+			if c.IsSet("unlock-passphrase-file") {
+				prompt.SetUnlockFile(c.String("unlock-passphrase-file"))
+			}
+			if !ownOutput && c.IsSet("output") {
+				if err := output.SetFormat(c.String("output")); err != nil {
+					return err
+				}
+			}
+			if before != nil {
+				return before(c)
+			}
+			return nil
+		}
+
+		addGlobalFlags(cmd.Subcommands)
+	}
+}
+
+func hasFlag(cmd *cli.Command, name string) bool {
+	for _, flag := range cmd.Flags {
+		for _, flagName := range flag.Names() {
+			if flagName == name {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,169 @@
+package exec
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	osexec "os/exec"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+
+	"github.com/urfave/cli/v2"
+	"github.com/yourusername/lockbox/internal/crypto"
+	"github.com/yourusername/lockbox/internal/dotenv"
+	"github.com/yourusername/lockbox/internal/git"
+	"github.com/yourusername/lockbox/internal/prompt"
+)
+
+func Command() *cli.Command {
+	return &cli.Command{
+		Name:      "exec",
+		Usage:     "Run a command with secrets injected as environment variables",
+		ArgsUsage: "-- <command> [args...]",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:  "env",
+				Usage: "Secret store to load, from .lockbox/secrets/<env>.age",
+			},
+			&cli.StringFlag{
+				Name:  "file",
+				Usage: "Encrypted dotenv file to load instead of a secret store",
+			},
+		},
+		Action: func(c *cli.Context) error {
+			if c.NArg() == 0 {
+				return fmt.Errorf("usage: lockbox exec [--env <env> | --file <file>] -- <command> [args...]")
+			}
+			if c.IsSet("env") && c.IsSet("file") {
+				return fmt.Errorf("--env and --file can't be used together")
+			}
+
+			gitRoot, err := git.FindRoot()
+			if err != nil {
+				return err
+			}
+
+			km, err := crypto.NewKeyManager()
+			if err != nil {
+				return err
+			}
+			km.SetLocalDir(filepath.Join(gitRoot, ".lockbox"))
+			km.SetPassphraseFunc(prompt.KeyPassphrase)
+
+			// Secrets are only ever held in memory and passed to the child
+			// through its environment
+			var secrets map[string]string
+			if c.IsSet("file") {
+				d, err := km.NewDecryptor()
+				if err != nil {
+					return err
+				}
+				plaintext, err := d.ReadFile(c.String("file"))
+				if err != nil {
+					return err
+				}
+				if secrets, err = dotenv.Parse(plaintext); err != nil {
+					return fmt.Errorf("failed to parse %s: %w", c.String("file"), err)
+				}
+			} else {
+				env := c.String("env")
+				if env == "" {
+					env = crypto.DefaultEnv
+				}
+				if secrets, err = km.LoadStore(env); err != nil {
+					return err
+				}
+			}
+
+			return run(c.Args().Slice(), secrets)
+		},
+	}
+}
+
+// run starts the command with secrets added to the current environment,
+// forwards signals to it and exits with its exit code
+func run(args []string, secrets map[string]string) error {
+	path, err := osexec.LookPath(args[0])
+	if err != nil {
+		return err
+	}
+
+	cmd := osexec.Command(path, args[1:]...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.Env = mergeEnv(os.Environ(), secrets)
+
+	// In a terminal the child stays in lockbox's process group, so it can read
+	// from the terminal and gets Ctrl-C from it directly. Otherwise it gets a
+	// group of its own, and every signal reaches it through lockbox.
+	forward := make(map[os.Signal]bool)
+	for _, sig := range forwardedSignals {
+		forward[sig] = true
+	}
+	if !prompt.IsInteractive() && ownProcessGroup(cmd) {
+		for _, sig := range groupSignals {
+			forward[sig] = true
+		}
+	}
+
+	// Group signals are caught either way, so lockbox outlives the child and
+	// can exit with its exit code
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, append(append([]os.Signal(nil), forwardedSignals...), groupSignals...)...)
+	defer signal.Stop(signals)
+
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to start %s: %w", args[0], err)
+	}
+
+	go func() {
+		for sig := range signals {
+			if forward[sig] {
+				cmd.Process.Signal(sig)
+			}
+		}
+	}()
+
+	err = cmd.Wait()
+	var exitErr *osexec.ExitError
+	if errors.As(err, &exitErr) {
+		if status, ok := exitErr.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+			// Report death by signal the way shells do
+			return cli.Exit("", 128+int(status.Signal()))
+		}
+		return cli.Exit("", exitErr.ExitCode())
+	}
+
+	return err
+}
+
+// mergeEnv returns environ with secrets added, replacing any variables of the same name
+func mergeEnv(environ []string, secrets map[string]string) []string {
+	var env []string
+	for _, entry := range environ {
+		// Windows has variables like "=C:=C:\", so the name can start with "="
+		name := entry
+		if i := strings.Index(entry[min(1, len(entry)):], "="); i >= 0 {
+			name = entry[:i+1]
+		}
+		if _, ok := secrets[name]; !ok {
+			env = append(env, entry)
+		}
+	}
+
+	var names []string
+	for name := range secrets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		env = append(env, name+"="+secrets[name])
+	}
+
+	return env
+}
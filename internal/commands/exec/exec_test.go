@@ -0,0 +1,67 @@
+package exec
+
+import (
+	"errors"
+	"os"
+	"reflect"
+	"runtime"
+	"testing"
+
+	"github.com/urfave/cli/v2"
+)
+
+func TestMergeEnv(t *testing.T) {
+	environ := []string{"PATH=/bin", "API_KEY=old", "=C:=C:\\", "EMPTY="}
+	secrets := map[string]string{"API_KEY": "new", "DB_URL": "postgres://"}
+
+	got := mergeEnv(environ, secrets)
+	want := []string{"PATH=/bin", "=C:=C:\\", "EMPTY=", "API_KEY=new", "DB_URL=postgres://"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+}
+
+// exitCode runs args and returns the exit code run reports
+func exitCode(t *testing.T, args ...string) int {
+	t.Helper()
+	err := run(args, map[string]string{"LOCKBOX_TEST_SECRET": "abc"})
+	if err == nil {
+		return 0
+	}
+
+	var exitErr cli.ExitCoder
+	if !errors.As(err, &exitErr) {
+		t.Fatal(err)
+	}
+	return exitErr.ExitCode()
+}
+
+func TestRun(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses sh")
+	}
+
+	if code := exitCode(t, "sh", "-c", `test "$LOCKBOX_TEST_SECRET" = abc`); code != 0 {
+		t.Errorf("expected the secret in the environment, got exit code %d", code)
+	}
+	if code := exitCode(t, "sh", "-c", "exit 7"); code != 7 {
+		t.Errorf("expected exit code 7, got %d", code)
+	}
+
+	// Signals sent to lockbox reach the child once
+	script := `n=0; trap 'n=$((n+1))' INT; trap 'exit $((10+n))' TERM; kill -INT $PPID; sleep 1; kill -TERM $PPID; while :; do sleep 1; done`
+	if code := exitCode(t, "sh", "-c", script); code != 11 {
+		t.Errorf("expected one SIGINT and a SIGTERM to be forwarded, got exit code %d", code)
+	}
+}
+
+func TestRunOwnProcessGroup(t *testing.T) {
+	if _, err := os.Stat("/proc/self/stat"); err != nil {
+		t.Skip("needs /proc")
+	}
+
+	// Without a terminal, the child leads its own process group
+	if code := exitCode(t, "sh", "-c", `test "$(cut -d' ' -f5 /proc/$$/stat)" = "$$"`); code != 0 {
+		t.Error("expected the child to run in its own process group")
+	}
+}
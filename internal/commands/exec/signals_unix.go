@@ -0,0 +1,33 @@
+//go:build !windows
+
+package exec
+
+import (
+	"os"
+	osexec "os/exec"
+	"syscall"
+)
+
+// forwardedSignals are passed on to the child process
+var forwardedSignals = []os.Signal{
+	syscall.SIGTERM,
+	syscall.SIGHUP,
+	syscall.SIGUSR1,
+	syscall.SIGUSR2,
+}
+
+// groupSignals are sent by the terminal to its whole foreground process
+// group, so a child in lockbox's group already receives them. They are only
+// passed on when the child runs in a process group of its own.
+var groupSignals = []os.Signal{
+	syscall.SIGINT,
+	syscall.SIGQUIT,
+	syscall.SIGWINCH,
+}
+
+// ownProcessGroup starts cmd in a new process group, so signals sent to
+// lockbox's group reach it only once, through lockbox
+func ownProcessGroup(cmd *osexec.Cmd) bool {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	return true
+}
@@ -0,0 +1,20 @@
+//go:build windows
+
+package exec
+
+import (
+	"os"
+	osexec "os/exec"
+)
+
+// forwardedSignals are passed on to the child process
+var forwardedSignals = []os.Signal{}
+
+// groupSignals reach every process attached to the console, the child
+// included, so they are never passed on
+var groupSignals = []os.Signal{os.Interrupt}
+
+// ownProcessGroup is not supported on Windows
+func ownProcessGroup(cmd *osexec.Cmd) bool {
+	return false
+}
@@ -0,0 +1,307 @@
+package gitfilter
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/urfave/cli/v2"
+	"github.com/yourusername/lockbox/internal/crypto"
+	"github.com/yourusername/lockbox/internal/git"
+	"github.com/yourusername/lockbox/internal/output"
+)
+
+func Command() *cli.Command {
+	return &cli.Command{
+		Name:  "git-filter",
+		Usage: "Encrypt files transparently with a git clean/smudge filter",
+		Subcommands: []*cli.Command{
+			installCommand(),
+			cleanCommand(),
+			smudgeCommand(),
+		},
+	}
+}
+
+func installCommand() *cli.Command {
+	return &cli.Command{
+		Name:      "install",
+		Usage:     "Configure the lockbox filter and add patterns to .gitattributes",
+		ArgsUsage: "[pattern...]",
+		Action: func(c *cli.Context) error {
+			gitRoot, err := git.FindRoot()
+			if err != nil {
+				return err
+			}
+
+			config := [][2]string{
+				{"filter.lockbox.clean", "lockbox git-filter clean %f"},
+				{"filter.lockbox.smudge", "lockbox git-filter smudge %f"},
+				{"filter.lockbox.required", "true"},
+				{"diff.lockbox.textconv", "lockbox git-textconv"},
+			}
+			for _, entry := range config {
+				if err := git.SetConfig(gitRoot, entry[0], entry[1]); err != nil {
+					return err
+				}
+			}
+			output.Successf("Configured the lockbox filter in .git/config")
+
+			added, err := git.AddAttributes(gitRoot, c.Args().Slice(), "filter=lockbox", "diff=lockbox")
+			if err != nil {
+				return err
+			}
+			for _, pattern := range added {
+				output.Successf("Added %s to .gitattributes", pattern)
+			}
+
+			if c.NArg() == 0 {
+				output.Infof("Add patterns with 'lockbox git-filter install <pattern>...' or edit .gitattributes:")
+				output.Println("  secrets/** filter=lockbox diff=lockbox")
+			} else {
+				output.Infof("Files that are already committed are encrypted the next time they change, or run 'git add --renormalize .'")
+			}
+
+			return nil
+		},
+	}
+}
+
+func cleanCommand() *cli.Command {
+	return &cli.Command{
+		Name:      "clean",
+		Usage:     "Encrypt stdin for the team (run by git on add)",
+		ArgsUsage: "<path>",
+		Hidden:    true,
+		Action: func(c *cli.Context) error {
+			// stdout carries the file contents
+			output.SetOutput(os.Stderr)
+
+			path := c.Args().First()
+			data, err := io.ReadAll(os.Stdin)
+			if err != nil {
+				return fmt.Errorf("failed to read %s: %w", path, err)
+			}
+
+			// Files that are still encrypted, e.g. because they were checked
+			// out without a key, are stored as they are
+			if crypto.HasEncryptedHeader(data) {
+				_, err := os.Stdout.Write(data)
+				return err
+			}
+
+			gitRoot, km, err := keyManager()
+			if err != nil {
+				return err
+			}
+
+			members, _, err := km.RecipientsFor(path)
+			if err != nil {
+				return err
+			}
+
+			// age encryption is randomized, so reuse the previous ciphertext
+			// while the plaintext and recipients stay the same. Otherwise git
+			// would see every file as modified.
+			cache, err := loadCache(gitRoot)
+			if err != nil {
+				return err
+			}
+
+			sum := sha256.Sum256(data)
+			entry := cacheEntry{
+				PlaintextHash:  hex.EncodeToString(sum[:]),
+				RecipientsHash: crypto.MembersHash(members),
+			}
+			if cached, ok := cache[path]; ok && cached.PlaintextHash == entry.PlaintextHash && cached.RecipientsHash == entry.RecipientsHash {
+				if ciphertext, err := git.ReadBlob(gitRoot, cached.Blob); err == nil {
+					_, err := os.Stdout.Write(ciphertext)
+					return err
+				}
+			}
+
+			ciphertext, err := km.Encrypt(data, path)
+			if err != nil {
+				return err
+			}
+
+			if entry.Blob, err = git.HashObject(gitRoot, ciphertext, true); err != nil {
+				return err
+			}
+			cache[path] = entry
+			if err := saveCache(gitRoot, cache); err != nil {
+				return err
+			}
+
+			_, err = os.Stdout.Write(ciphertext)
+			return err
+		},
+	}
+}
+
+func smudgeCommand() *cli.Command {
+	return &cli.Command{
+		Name:      "smudge",
+		Usage:     "Decrypt stdin with your keys (run by git on checkout)",
+		ArgsUsage: "<path>",
+		Hidden:    true,
+		Action: func(c *cli.Context) error {
+			output.SetOutput(os.Stderr)
+
+			path := c.Args().First()
+			data, err := io.ReadAll(os.Stdin)
+			if err != nil {
+				return fmt.Errorf("failed to read %s: %w", path, err)
+			}
+
+			if !crypto.HasEncryptedHeader(data) {
+				_, err := os.Stdout.Write(data)
+				return err
+			}
+
+			// A failed smudge would abort the checkout, so files we can't
+			// decrypt are checked out encrypted instead
+			plaintext, err := decrypt(data, path)
+			if err != nil {
+				output.Warnf("%s: %v, leaving it encrypted", path, err)
+				_, err := os.Stdout.Write(data)
+				return err
+			}
+
+			_, err = os.Stdout.Write(plaintext)
+			return err
+		},
+	}
+}
+
+// decrypt decrypts data and remembers the ciphertext for clean, so checking
+// out a file doesn't make it look modified
+func decrypt(data []byte, path string) ([]byte, error) {
+	gitRoot, km, err := keyManager()
+	if err != nil {
+		return nil, err
+	}
+
+	d, err := km.NewDecryptor()
+	if err != nil {
+		return nil, err
+	}
+
+	plaintext, err := d.Decrypt(data)
+	if err != nil {
+		return nil, err
+	}
+
+	members, _, err := km.RecipientsFor(path)
+	if err != nil {
+		return plaintext, nil
+	}
+
+	blob, err := git.HashObject(gitRoot, data, false)
+	if err != nil {
+		return plaintext, nil
+	}
+
+	sum := sha256.Sum256(plaintext)
+	if cache, err := loadCache(gitRoot); err == nil {
+		cache[path] = cacheEntry{
+			PlaintextHash:  hex.EncodeToString(sum[:]),
+			RecipientsHash: crypto.MembersHash(members),
+			Blob:           blob,
+		}
+		saveCache(gitRoot, cache)
+	}
+
+	return plaintext, nil
+}
+
+func keyManager() (string, *crypto.KeyManager, error) {
+	gitRoot, err := git.FindRoot()
+	if err != nil {
+		return "", nil, err
+	}
+
+	km, err := crypto.NewKeyManager()
+	if err != nil {
+		return "", nil, err
+	}
+	km.SetLocalDir(filepath.Join(gitRoot, ".lockbox"))
+
+	return gitRoot, km, nil
+}
+
+// cacheEntry remembers the ciphertext blob last stored for a path
+type cacheEntry struct {
+	PlaintextHash  string `json:"plaintext_hash"`
+	RecipientsHash string `json:"recipients_hash"`
+	Blob           string `json:"blob"`
+}
+
+// The cache lives in the git directory since it is specific to this clone
+func cachePath(gitRoot string) (string, error) {
+	gitDir, err := git.Dir(gitRoot)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(gitDir, "lockbox", "filter-cache.json"), nil
+}
+
+func loadCache(gitRoot string) (map[string]cacheEntry, error) {
+	path, err := cachePath(gitRoot)
+	if err != nil {
+		return nil, err
+	}
+
+	cache := make(map[string]cacheEntry)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return cache, nil
+		}
+		return nil, fmt.Errorf("failed to read filter cache: %w", err)
+	}
+
+	if err := json.Unmarshal(data, &cache); err != nil {
+		// The cache only saves work, so start over rather than fail
+		return make(map[string]cacheEntry), nil
+	}
+
+	return cache, nil
+}
+
+func saveCache(gitRoot string, cache map[string]cacheEntry) error {
+	path, err := cachePath(gitRoot)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("failed to create filter cache directory: %w", err)
+	}
+
+	data, err := json.MarshalIndent(cache, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal filter cache: %w", err)
+	}
+
+	// Filters may run in parallel during checkout, so replace the file atomically
+	tmp, err := os.CreateTemp(filepath.Dir(path), "filter-cache-*.json")
+	if err != nil {
+		return fmt.Errorf("failed to write filter cache: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write filter cache: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write filter cache: %w", err)
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
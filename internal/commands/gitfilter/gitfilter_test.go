@@ -0,0 +1,71 @@
+package gitfilter
+
+import (
+	"os"
+	"os/exec"
+	"testing"
+
+	"github.com/yourusername/lockbox/internal/git"
+)
+
+func newGitRepo(t *testing.T) string {
+	t.Helper()
+	root := t.TempDir()
+	if out, err := exec.Command("git", "-C", root, "init", "-q").CombinedOutput(); err != nil {
+		t.Fatalf("git init: %v\n%s", err, out)
+	}
+	return root
+}
+
+func TestCacheRoundTrip(t *testing.T) {
+	root := newGitRepo(t)
+
+	cache, err := loadCache(root)
+	if err != nil || len(cache) != 0 {
+		t.Fatalf("expected an empty cache, got %v (%v)", cache, err)
+	}
+
+	ciphertext := []byte("age-encryption.org/v1\nnot really\n")
+	blob, err := git.HashObject(root, ciphertext, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cache["secrets/prod.env"] = cacheEntry{PlaintextHash: "p", RecipientsHash: "r", Blob: blob}
+	if err := saveCache(root, cache); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := loadCache(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded["secrets/prod.env"] != cache["secrets/prod.env"] {
+		t.Errorf("expected %+v, got %+v", cache["secrets/prod.env"], loaded["secrets/prod.env"])
+	}
+
+	// clean reuses the ciphertext from the stored blob
+	stored, err := git.ReadBlob(root, loaded["secrets/prod.env"].Blob)
+	if err != nil || string(stored) != string(ciphertext) {
+		t.Errorf("expected the stored ciphertext back, got %q (%v)", stored, err)
+	}
+}
+
+func TestLoadCacheIgnoresCorruptFile(t *testing.T) {
+	root := newGitRepo(t)
+	path, err := cachePath(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := saveCache(root, map[string]cacheEntry{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte("{not json"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	cache, err := loadCache(root)
+	if err != nil || len(cache) != 0 {
+		t.Errorf("expected a corrupt cache to start over empty, got %v (%v)", cache, err)
+	}
+}
@@ -0,0 +1,276 @@
+package hooks
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/urfave/cli/v2"
+	"github.com/yourusername/lockbox/internal/crypto"
+	"github.com/yourusername/lockbox/internal/git"
+	"github.com/yourusername/lockbox/internal/output"
+)
+
+// hookMarker identifies hooks written by lockbox, so they can be updated
+const hookMarker = "# Installed by lockbox"
+
+const preCommitHook = `#!/bin/sh
+` + hookMarker + `: blocks committing plaintext secrets.
+# Bypass with 'git commit --no-verify' if you are sure.
+exec lockbox hooks pre-commit
+`
+
+func Command() *cli.Command {
+	return &cli.Command{
+		Name:  "hooks",
+		Usage: "Manage git hooks that stop plaintext secrets from being committed",
+		Subcommands: []*cli.Command{
+			installCommand(),
+			preCommitCommand(),
+		},
+	}
+}
+
+func installCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "install",
+		Usage: "Install the lockbox pre-commit hook",
+		Flags: []cli.Flag{
+			&cli.BoolFlag{
+				Name:  "force",
+				Usage: "Replace an existing pre-commit hook that wasn't installed by lockbox",
+			},
+		},
+		Action: func(c *cli.Context) error {
+			gitRoot, err := git.FindRoot()
+			if err != nil {
+				return err
+			}
+
+			hooksDir, err := git.HooksDir(gitRoot)
+			if err != nil {
+				return err
+			}
+
+			hookPath := filepath.Join(hooksDir, "pre-commit")
+			if existing, err := os.ReadFile(hookPath); err == nil && !strings.Contains(string(existing), hookMarker) && !c.Bool("force") {
+				return fmt.Errorf("%s already exists. Add 'lockbox hooks pre-commit' to it, or pass --force to replace it", hookPath)
+			}
+
+			if err := os.MkdirAll(hooksDir, 0755); err != nil {
+				return fmt.Errorf("failed to create hooks directory: %w", err)
+			}
+			if err := os.WriteFile(hookPath, []byte(preCommitHook), 0755); err != nil {
+				return fmt.Errorf("failed to write pre-commit hook: %w", err)
+			}
+
+			output.Successf("Installed pre-commit hook at %s", hookPath)
+			return nil
+		},
+	}
+}
+
+// problem is a staged file that must not be committed, with how to fix it
+type problem struct {
+	path   string
+	reason string
+	fix    []string
+}
+
+func preCommitCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "pre-commit",
+		Usage: "Check staged files for plaintext secrets (run by the pre-commit hook)",
+		Action: func(c *cli.Context) error {
+			gitRoot, err := git.FindRoot()
+			if err != nil {
+				return err
+			}
+
+			km, err := crypto.NewKeyManager()
+			if err != nil {
+				return err
+			}
+			km.SetLocalDir(filepath.Join(gitRoot, ".lockbox"))
+
+			staged, err := git.StagedFiles(gitRoot)
+			if err != nil {
+				return err
+			}
+
+			known, err := knownPlaintext(km, gitRoot)
+			if err != nil {
+				return err
+			}
+
+			var problems []problem
+			for _, file := range staged {
+				if path.Base(file) == "private.key" && path.Base(path.Dir(file)) == ".lockbox" {
+					problems = append(problems, problem{
+						path:   file,
+						reason: "is a lockbox private key",
+						fix:    unstageFix(gitRoot, file),
+					})
+					continue
+				}
+
+				secret, ok := known.match(gitRoot, file)
+				if !ok {
+					continue
+				}
+
+				// Files the git filter encrypts are staged as ciphertext
+				if filter, err := git.Attribute(gitRoot, file, "filter"); err == nil && filter == "lockbox" {
+					continue
+				}
+
+				reason := "is the plaintext of a lockbox secret"
+				if secret != file {
+					reason = fmt.Sprintf("has the same contents as the plaintext of %s", secret)
+				}
+				problems = append(problems, problem{
+					path:   file,
+					reason: reason,
+					fix:    unstageFix(gitRoot, file),
+				})
+			}
+
+			unignored, err := unignoredPlaintext(gitRoot, known, problems)
+			if err != nil {
+				return err
+			}
+			problems = append(problems, unignored...)
+
+			if len(problems) == 0 {
+				return nil
+			}
+
+			for _, p := range problems {
+				output.Errorf("%s %s", p.path, p.reason)
+				for _, fix := range p.fix {
+					output.Printf("    %s\n", fix)
+				}
+			}
+			output.Println("\nCommit with --no-verify to skip this check.")
+
+			return fmt.Errorf("commit blocked: %d problem(s) with secrets", len(problems))
+		},
+	}
+}
+
+// unignoredPlaintext reports the known plaintext files that .gitignore
+// doesn't cover, so they can't be staged by accident later. Files already in
+// reported are skipped, as are files the git filter encrypts.
+func unignoredPlaintext(gitRoot string, known *plaintextIndex, reported []problem) ([]problem, error) {
+	seen := make(map[string]bool)
+	for _, p := range reported {
+		seen[p.path] = true
+	}
+
+	var paths []string
+	for file := range known.paths {
+		if !seen[file] {
+			paths = append(paths, file)
+		}
+	}
+	sort.Strings(paths)
+
+	var problems []problem
+	for _, file := range paths {
+		if filter, err := git.Attribute(gitRoot, file, "filter"); err == nil && filter == "lockbox" {
+			continue
+		}
+
+		ignored, err := git.InGitignore(gitRoot, file)
+		if err != nil {
+			return nil, err
+		}
+		if !ignored {
+			problems = append(problems, problem{
+				path:   file,
+				reason: "is the plaintext of a lockbox secret but is not in .gitignore",
+				fix:    []string{fmt.Sprintf("echo '%s' >> .gitignore", file)},
+			})
+		}
+	}
+
+	return problems, nil
+}
+
+// unstageFix suggests commands that unstage file and keep it out of git
+func unstageFix(gitRoot string, file string) []string {
+	fix := []string{"git rm --cached " + file}
+	if ignored, err := git.InGitignore(gitRoot, file); err == nil && !ignored {
+		fix = append(fix, fmt.Sprintf("echo '%s' >> .gitignore", file))
+	}
+	return fix
+}
+
+// plaintextIndex finds staged files that are the plaintext of a known
+// secret, either by path or by content
+type plaintextIndex struct {
+	paths  map[string]bool   // repository-relative plaintext paths from the manifest
+	hashes map[string]string // sha256 -> repository-relative plaintext path
+}
+
+func knownPlaintext(km *crypto.KeyManager, gitRoot string) (*plaintextIndex, error) {
+	index := &plaintextIndex{
+		paths:  make(map[string]bool),
+		hashes: make(map[string]string),
+	}
+
+	secrets, err := km.ListSecrets()
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range secrets {
+		// Secret stores have no plaintext file
+		if entry.Plaintext != entry.Ciphertext {
+			index.paths[entry.Plaintext] = true
+		}
+	}
+
+	hashes, err := km.PlaintextHashes()
+	if err != nil {
+		return nil, err
+	}
+	for absPath, sum := range hashes {
+		relPath, err := filepath.Rel(gitRoot, absPath)
+		if err != nil || strings.HasPrefix(relPath, "..") {
+			continue
+		}
+		index.hashes[sum] = filepath.ToSlash(relPath)
+	}
+
+	return index, nil
+}
+
+// match returns the known plaintext path that file is, or duplicates
+func (i *plaintextIndex) match(gitRoot string, file string) (string, bool) {
+	if i.paths[file] {
+		return file, true
+	}
+
+	if len(i.hashes) == 0 {
+		return "", false
+	}
+
+	data, err := git.ReadBlob(gitRoot, ":"+file)
+	if err != nil {
+		return "", false
+	}
+
+	// Empty files would match every empty secret
+	if len(data) == 0 {
+		return "", false
+	}
+
+	sum := sha256.Sum256(data)
+	secret, ok := i.hashes[hex.EncodeToString(sum[:])]
+	return secret, ok
+}
@@ -0,0 +1,95 @@
+package hooks
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+// newGitRepo creates a git repository with the given files, staging all of them
+func newGitRepo(t *testing.T, files map[string]string) string {
+	t.Helper()
+	root := t.TempDir()
+
+	if out, err := exec.Command("git", "-C", root, "init", "-q").CombinedOutput(); err != nil {
+		t.Fatalf("git init: %v\n%s", err, out)
+	}
+	for name, data := range files {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if out, err := exec.Command("git", "-C", root, "add", "-A").CombinedOutput(); err != nil {
+		t.Fatalf("git add: %v\n%s", err, out)
+	}
+
+	return root
+}
+
+func sha256Hex(data string) string {
+	sum := sha256.Sum256([]byte(data))
+	return hex.EncodeToString(sum[:])
+}
+
+func TestPlaintextIndexMatch(t *testing.T) {
+	root := newGitRepo(t, map[string]string{
+		"config/prod.env": "API_KEY=abc\n",
+		"backup.env":      "API_KEY=abc\n",
+		"empty.txt":       "",
+		"README.md":       "hello\n",
+	})
+
+	index := &plaintextIndex{
+		paths:  map[string]bool{"config/prod.env": true},
+		hashes: map[string]string{sha256Hex("API_KEY=abc\n"): "config/prod.env", sha256Hex(""): "empty.env"},
+	}
+
+	tests := []struct {
+		file   string
+		secret string
+		ok     bool
+	}{
+		{file: "config/prod.env", secret: "config/prod.env", ok: true},
+		{file: "backup.env", secret: "config/prod.env", ok: true},
+		{file: "empty.txt", ok: false},
+		{file: "README.md", ok: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			secret, ok := index.match(root, tt.file)
+			if secret != tt.secret || ok != tt.ok {
+				t.Errorf("expected (%q, %v), got (%q, %v)", tt.secret, tt.ok, secret, ok)
+			}
+		})
+	}
+}
+
+func TestUnignoredPlaintext(t *testing.T) {
+	root := newGitRepo(t, map[string]string{
+		".gitignore":     "ignored.env\n",
+		".gitattributes": "filtered.env filter=lockbox\n",
+	})
+
+	index := &plaintextIndex{paths: map[string]bool{
+		"ignored.env":  true,
+		"filtered.env": true,
+		"exposed.env":  true,
+		"staged.env":   true,
+	}}
+	reported := []problem{{path: "staged.env"}}
+
+	problems, err := unignoredPlaintext(root, index, reported)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(problems) != 1 || problems[0].path != "exposed.env" {
+		t.Errorf("expected only exposed.env to be reported, got %+v", problems)
+	}
+}
@@ -4,8 +4,11 @@ import (
 	"fmt"
 	"github.com/urfave/cli/v2"
 	"github.com/yourusername/lockbox/internal/crypto"
-	"github.com/yourusername/lockbox/internal/prompt"
+	"github.com/yourusername/lockbox/internal/git"
 	"github.com/yourusername/lockbox/internal/output"
+	"github.com/yourusername/lockbox/internal/prompt"
+	"os"
+	"path/filepath"
 )
 
 func Command() *cli.Command {
@@ -16,18 +19,58 @@ func Command() *cli.Command {
 			addCommand(),
 			removeCommand(),
 			listCommand(),
+			passwdCommand(),
+			machineCommand(),
 		},
 	}
 }
 
 func addCommand() *cli.Command {
 	return &cli.Command{
-		Name:  "add",
-		Usage: "Create a new personal key",
+		Name:      "add",
+		Usage:     "Create a new personal key",
+		ArgsUsage: "[name]",
+		Flags: []cli.Flag{
+			passphraseFileFlag(),
+			&cli.BoolFlag{
+				Name:  "no-passphrase",
+				Usage: "Store the key without a passphrase",
+			},
+		},
 		Action: func(c *cli.Context) error {
-			name, err := prompt.Input("Enter a name for the key")
-			if err != nil {
-				return err
+			name := c.Args().First()
+			if name == "" {
+				var err error
+				name, err = prompt.Input("Enter a name for the key")
+				if err != nil {
+					return err
+				}
+			}
+
+			var passphrase string
+			switch {
+			case c.IsSet("passphrase-file"):
+				var err error
+				passphrase, err = prompt.ReadPassphraseFile(c.String("passphrase-file"))
+				if err != nil {
+					return err
+				}
+			case c.Bool("no-passphrase"):
+			default:
+				protect, err := prompt.Confirm("Protect this key with a passphrase?")
+				if err != nil {
+					return err
+				}
+
+				if protect {
+					passphrase, err = prompt.NewPassphrase("Enter passphrase")
+					if err != nil {
+						return err
+					}
+					if passphrase == "" {
+						output.Warnf("Empty passphrase, key will be stored unprotected")
+					}
+				}
 			}
 
 			km, err := crypto.NewKeyManager()
@@ -35,13 +78,14 @@ func addCommand() *cli.Command {
 				return err
 			}
 
-			identity, err := km.GenerateKeyPair(name)
+			identity, err := km.GenerateProtectedKeyPair(name, passphrase)
 			if err != nil {
 				return err
 			}
 
 			output.Successf("Created new key for %s", identity.Name)
 			output.Infof("Public key: %s", identity.PublicKey)
+			output.Infof("Fingerprint: %s (%s)", identity.Fingerprint(), identity.FingerprintWords())
 			return nil
 		},
 	}
@@ -49,40 +93,30 @@ func addCommand() *cli.Command {
 
 func removeCommand() *cli.Command {
 	return &cli.Command{
-		Name:  "remove",
-		Usage: "Remove a personal key",
+		Name:      "remove",
+		Usage:     "Remove a personal key",
+		ArgsUsage: "[name]",
+		Flags: []cli.Flag{
+			yesFlag(),
+		},
 		Action: func(c *cli.Context) error {
 			km, err := crypto.NewKeyManager()
 			if err != nil {
 				return err
 			}
 
-			identities, err := km.ListPersonalKeys()
-			if err != nil {
-				return err
-			}
-
-			if len(identities) == 0 {
-				return fmt.Errorf("no keys found")
-			}
-
-			var options []string
-			for _, id := range identities {
-				options = append(options, id.Name)
-			}
-
-			selected, err := prompt.SelectFromList("Select a key to remove", options)
+			selected, err := selectKey(km, c.Args().First(), "Select a key to remove")
 			if err != nil {
 				return err
 			}
 
-			confirmed, err := prompt.Confirm(fmt.Sprintf("Are you sure you want to remove key '%s'?", selected))
+			confirmed, err := prompt.ConfirmUnless(c.Bool("yes"), fmt.Sprintf("Are you sure you want to remove key '%s'?", selected))
 			if err != nil {
 				return err
 			}
 
 			if !confirmed {
-				fmt.Println("Operation cancelled")
+				output.Println("Operation cancelled")
 				return nil
 			}
 
@@ -90,7 +124,7 @@ func removeCommand() *cli.Command {
 				return err
 			}
 
-			fmt.Printf("Removed key %s\n", selected)
+			output.Printf("Removed key %s\n", selected)
 			return nil
 		},
 	}
@@ -111,6 +145,19 @@ func listCommand() *cli.Command {
 				return err
 			}
 
+			if output.Structured() {
+				list := output.KeyList{Keys: []output.Key{}}
+				for _, identity := range identities {
+					list.Keys = append(list.Keys, output.Key{
+						Name:        identity.Name,
+						Key:         identity.PublicKey,
+						Fingerprint: identity.Fingerprint(),
+						Protected:   identity.Protected(),
+					})
+				}
+				return output.Print(list)
+			}
+
 			if len(identities) == 0 {
 				output.Infof("No personal keys found")
 				return nil
@@ -118,10 +165,149 @@ func listCommand() *cli.Command {
 
 			output.Section("Your keys")
 			for _, identity := range identities {
-				output.ListItem(fmt.Sprintf("%s: %s", identity.Name, identity.PublicKey))
+				line := fmt.Sprintf("%s [%s]: %s", identity.Name, identity.Fingerprint(), identity.PublicKey)
+				if identity.Protected() {
+					line += " (passphrase-protected)"
+				}
+				output.ListItem(line)
 			}
 
 			return nil
 		},
 	}
-} 
\ No newline at end of file
+}
+
+func passwdCommand() *cli.Command {
+	return &cli.Command{
+		Name:        "passwd",
+		Usage:       "Add, change or remove the passphrase on a personal key",
+		Description: "The current passphrase is read from --unlock-passphrase-file and the new one from --passphrase-file when they are given",
+		ArgsUsage:   "[name]",
+		Flags: []cli.Flag{
+			passphraseFileFlag(),
+		},
+		Action: func(c *cli.Context) error {
+			km, err := crypto.NewKeyManager()
+			if err != nil {
+				return err
+			}
+			km.SetPassphraseFunc(prompt.KeyPassphrase)
+
+			selected, err := selectKey(km, c.Args().First(), "Select a key")
+			if err != nil {
+				return err
+			}
+
+			var passphrase string
+			err = km.ChangePassphrase(selected, func() (string, error) {
+				if c.IsSet("passphrase-file") {
+					passphrase, err = prompt.ReadPassphraseFile(c.String("passphrase-file"))
+				} else {
+					passphrase, err = prompt.NewPassphrase("Enter new passphrase (leave empty to remove protection)")
+				}
+				return passphrase, err
+			})
+			if err != nil {
+				return err
+			}
+
+			if passphrase == "" {
+				output.Successf("Removed passphrase from key %s", selected)
+			} else {
+				output.Successf("Updated passphrase for key %s", selected)
+			}
+			return nil
+		},
+	}
+}
+
+func machineCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "machine",
+		Usage: "Manage identities for CI jobs and other machines",
+		Subcommands: []*cli.Command{
+			{
+				Name:      "create",
+				Usage:     "Create a machine identity and add it to the team",
+				ArgsUsage: "<name>",
+				Action: func(c *cli.Context) error {
+					if c.NArg() != 1 {
+						return fmt.Errorf("usage: lockbox key machine create <name>")
+					}
+
+					gitRoot, err := git.FindRoot()
+					if err != nil {
+						return err
+					}
+
+					km, err := crypto.NewKeyManager()
+					if err != nil {
+						return err
+					}
+					km.SetLocalDir(filepath.Join(gitRoot, ".lockbox"))
+					km.SetPassphraseFunc(prompt.KeyPassphrase)
+
+					identity, member, err := km.GenerateMachineKey(c.Args().First())
+					if err != nil {
+						return err
+					}
+
+					// We just made this key, so there is no fingerprint to compare
+					if err := km.MarkVerified(identity); err != nil {
+						return err
+					}
+
+					// Only the secret goes to stdout, so it can be piped into a CI secret store
+					output.SetOutput(os.Stderr)
+					output.Successf("Added machine %s to the team", member.Name)
+					output.Infof("Public key: %s", member.PublicKey)
+					output.Infof("Fingerprint: %s", member.Fingerprint())
+					output.Warnf("The private key below is shown once and not stored. Save it as the %s secret of your CI job", crypto.EnvIdentity)
+					fmt.Println(identity.PrivateKey)
+					return nil
+				},
+			},
+		},
+	}
+}
+
+// selectKey returns name if it is one of the user's keys, or asks for a key when name is empty
+func selectKey(km *crypto.KeyManager, name string, message string) (string, error) {
+	identities, err := km.ListPersonalKeys()
+	if err != nil {
+		return "", err
+	}
+
+	if len(identities) == 0 {
+		return "", fmt.Errorf("no keys found")
+	}
+
+	var options []string
+	for _, id := range identities {
+		if id.Name == name {
+			return name, nil
+		}
+		options = append(options, id.Name)
+	}
+
+	if name != "" {
+		return "", fmt.Errorf("no personal key named %s", name)
+	}
+
+	return prompt.SelectFromList(message, options)
+}
+
+func passphraseFileFlag() cli.Flag {
+	return &cli.StringFlag{
+		Name:  "passphrase-file",
+		Usage: "Read the new passphrase from `FILE` (- for stdin). An empty passphrase means none",
+	}
+}
+
+func yesFlag() cli.Flag {
+	return &cli.BoolFlag{
+		Name:    "yes",
+		Aliases: []string{"y"},
+		Usage:   "Don't ask for confirmation",
+	}
+}
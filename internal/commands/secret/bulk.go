@@ -0,0 +1,315 @@
+package secret
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/urfave/cli/v2"
+	"github.com/yourusername/lockbox/internal/crypto"
+	"github.com/yourusername/lockbox/internal/git"
+	"github.com/yourusername/lockbox/internal/output"
+	"github.com/yourusername/lockbox/internal/prompt"
+)
+
+// isBulk reports whether the arguments name more than one file, i.e. there
+// are several of them or one is a directory or a glob
+func isBulk(c *cli.Context) bool {
+	if c.Bool("recursive") {
+		return true
+	}
+	if c.NArg() > 1 {
+		// A second "-" is the output, not another file
+		return c.NArg() > 2 || c.Args().Get(1) != crypto.StdioPath
+	}
+
+	arg := c.Args().First()
+	if arg == "" {
+		return false
+	}
+
+	info, err := os.Stat(arg)
+	if err != nil {
+		return isGlob(arg)
+	}
+	return info.IsDir()
+}
+
+func isGlob(arg string) bool {
+	return strings.ContainsAny(arg, "*?[")
+}
+
+// expandPaths turns file, directory and glob arguments into a sorted list of
+// files. Directories are only walked with recursive set, and only files that
+// include accepts are kept, however they were named. .git and .lockbox are
+// never entered.
+func expandPaths(args []string, recursive bool, include func(string) bool) ([]string, error) {
+	seen := make(map[string]bool)
+	var files []string
+	add := func(path string) {
+		path = filepath.Clean(path)
+		if !seen[path] {
+			seen[path] = true
+			files = append(files, path)
+		}
+	}
+
+	for _, arg := range args {
+		paths := []string{arg}
+		if _, err := os.Stat(arg); err != nil && isGlob(arg) {
+			matches, err := filepath.Glob(arg)
+			if err != nil {
+				return nil, fmt.Errorf("invalid pattern %s: %w", arg, err)
+			}
+			if len(matches) == 0 {
+				return nil, fmt.Errorf("no files match %s", arg)
+			}
+			paths = matches
+		}
+
+		for _, path := range paths {
+			info, err := os.Stat(path)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read %s: %w", path, err)
+			}
+
+			if !info.IsDir() {
+				if include(path) {
+					add(path)
+				}
+				continue
+			}
+
+			if !recursive {
+				return nil, fmt.Errorf("%s is a directory, pass --recursive to include it", path)
+			}
+
+			err = filepath.WalkDir(path, func(walked string, entry fs.DirEntry, err error) error {
+				if err != nil {
+					return err
+				}
+				if entry.IsDir() {
+					if walked != path && (entry.Name() == ".git" || entry.Name() == ".lockbox") {
+						return filepath.SkipDir
+					}
+					return nil
+				}
+				if entry.Type().IsRegular() && include(walked) {
+					add(walked)
+				}
+				return nil
+			})
+			if err != nil {
+				return nil, fmt.Errorf("failed to walk %s: %w", path, err)
+			}
+		}
+	}
+
+	sort.Strings(files)
+	return files, nil
+}
+
+// runWorkers calls fn for every file on at most jobs goroutines and returns
+// the errors in the order of files
+func runWorkers(files []string, jobs int, fn func(string) error) []error {
+	errs := make([]error, len(files))
+	work := make(chan int)
+
+	var wg sync.WaitGroup
+	for w := 0; w < max(1, min(jobs, len(files))); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range work {
+				errs[i] = fn(files[i])
+			}
+		}()
+	}
+
+	for i := range files {
+		work <- i
+	}
+	close(work)
+	wg.Wait()
+
+	return errs
+}
+
+// printSummary reports the outcome of every file and returns an error if any failed
+func printSummary(verb string, files []string, outputPath func(string) string, errs []error) error {
+	var failed int
+	for i, path := range files {
+		if errs[i] != nil {
+			output.Errorf("%s: %v", path, errs[i])
+			failed++
+			continue
+		}
+		output.Successf("%s -> %s", path, outputPath(path))
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d files could not be %s", failed, len(files), strings.ToLower(verb))
+	}
+
+	output.Infof("%s %d file(s)", verb, len(files))
+	return nil
+}
+
+func bulkEncrypt(c *cli.Context) error {
+	if c.IsSet("output") {
+		return fmt.Errorf("--output can only be used with a single file")
+	}
+
+	structured := c.Bool("structured")
+	files, err := expandPaths(c.Args().Slice(), c.Bool("recursive"), func(path string) bool {
+		if strings.HasSuffix(path, ".encrypted") {
+			return false
+		}
+		if encrypted, err := crypto.IsEncrypted(path); err == nil && encrypted {
+			return false
+		}
+		return !structured || !crypto.IsStructured(path)
+	})
+	if err != nil {
+		return err
+	}
+
+	if len(files) == 0 {
+		output.Infof("No files to encrypt")
+		return nil
+	}
+
+	gitRoot, err := git.FindRoot()
+	if err != nil {
+		return err
+	}
+
+	km, err := crypto.NewKeyManager()
+	if err != nil {
+		return err
+	}
+	km.SetLocalDir(filepath.Join(gitRoot, ".lockbox"))
+	km.SetPassphraseFunc(prompt.KeyPassphrase)
+	km.SetAllowUntrusted(c.Bool("allow-untrusted"))
+	km.SetEnvelope(c.Bool("envelope"))
+
+	armored, err := armorSetting(c, km)
+	if err != nil {
+		return err
+	}
+	km.SetArmor(armored)
+
+	e, err := km.NewEncryptor()
+	if err != nil {
+		return err
+	}
+
+	output.Println("The following files will be encrypted:")
+	for _, path := range files {
+		members, _, err := e.Recipients(path)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		var names []string
+		for _, member := range members {
+			names = append(names, member.Name)
+		}
+		output.Printf("- %s -> %s.encrypted (%s)\n", path, path, strings.Join(names, ", "))
+	}
+
+	confirmed, err := prompt.ConfirmUnless(c.Bool("yes"), fmt.Sprintf("\nEncrypt %d file(s)?", len(files)))
+	if err != nil {
+		return err
+	}
+	if !confirmed {
+		output.Println("Operation cancelled")
+		return nil
+	}
+
+	errs := runWorkers(files, c.Int("jobs"), func(path string) error {
+		if structured {
+			return e.EncryptStructuredFile(path, path+".encrypted")
+		}
+		return e.EncryptFile(path, path+".encrypted")
+	})
+
+	return printSummary("Encrypted", files, func(path string) string {
+		return path + ".encrypted"
+	}, errs)
+}
+
+func bulkDecrypt(c *cli.Context) error {
+	if c.IsSet("output") {
+		return fmt.Errorf("--output can only be used with a single file")
+	}
+
+	files, err := expandPaths(c.Args().Slice(), c.Bool("recursive"), func(path string) bool {
+		if strings.HasSuffix(path, ".encrypted") {
+			return true
+		}
+		encrypted, err := crypto.IsEncrypted(path)
+		return err == nil && encrypted
+	})
+	if err != nil {
+		return err
+	}
+
+	if len(files) == 0 {
+		output.Infof("No encrypted files found")
+		return nil
+	}
+
+	gitRoot, err := git.FindRoot()
+	if err != nil {
+		return err
+	}
+
+	km, err := crypto.NewKeyManager()
+	if err != nil {
+		return err
+	}
+	km.SetLocalDir(filepath.Join(gitRoot, ".lockbox"))
+	km.SetPassphraseFunc(prompt.KeyPassphrase)
+
+	d, err := decryptorFor(c, km)
+	if err != nil {
+		return err
+	}
+
+	errs := runWorkers(files, c.Int("jobs"), func(path string) error {
+		return d.DecryptFile(path, decryptedPath(path))
+	})
+
+	return printSummary("Decrypted", files, decryptedPath, errs)
+}
+
+// decryptedPath is the default output path for an encrypted file
+func decryptedPath(path string) string {
+	plaintext := strings.TrimSuffix(path, ".encrypted")
+	if plaintext == path {
+		plaintext += ".decrypted"
+	}
+	return plaintext
+}
+
+func recursiveFlag() cli.Flag {
+	return &cli.BoolFlag{
+		Name:    "recursive",
+		Aliases: []string{"r"},
+		Usage:   "Include the files in directories and their subdirectories",
+	}
+}
+
+func jobsFlag() cli.Flag {
+	return &cli.IntFlag{
+		Name:    "jobs",
+		Aliases: []string{"j"},
+		Usage:   "Process up to `N` files at once",
+		Value:   runtime.NumCPU(),
+	}
+}
@@ -0,0 +1,174 @@
+package secret
+
+import (
+	"errors"
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/urfave/cli/v2"
+)
+
+// newTree creates the given files under a temporary directory
+func newTree(t *testing.T, files ...string) string {
+	t.Helper()
+	root := t.TempDir()
+	for _, name := range files {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(name), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return root
+}
+
+func TestExpandPaths(t *testing.T) {
+	root := newTree(t,
+		"a.env", "b.env", "notes.txt",
+		"config/prod.env", "config/deep/eu.env",
+		"config/.git/HEAD", "config/.lockbox/manifest",
+	)
+	rel := func(files []string) []string {
+		var out []string
+		for _, file := range files {
+			r, _ := filepath.Rel(root, file)
+			out = append(out, filepath.ToSlash(r))
+		}
+		return out
+	}
+	all := func(string) bool { return true }
+	envOnly := func(path string) bool { return strings.HasSuffix(path, ".env") }
+
+	tests := []struct {
+		name      string
+		args      []string
+		recursive bool
+		include   func(string) bool
+		want      []string
+		err       string
+	}{
+		{
+			name:    "files are sorted and deduplicated",
+			args:    []string{"b.env", "a.env", "b.env"},
+			include: all,
+			want:    []string{"a.env", "b.env"},
+		},
+		{
+			name:    "glob",
+			args:    []string{"*.env"},
+			include: all,
+			want:    []string{"a.env", "b.env"},
+		},
+		{
+			name:      "directory skips .git and .lockbox",
+			args:      []string{"config"},
+			recursive: true,
+			include:   all,
+			want:      []string{"config/deep/eu.env", "config/prod.env"},
+		},
+		{
+			name:      "include filters named files too",
+			args:      []string{"notes.txt", "."},
+			recursive: true,
+			include:   envOnly,
+			want:      []string{"a.env", "b.env", "config/deep/eu.env", "config/prod.env"},
+		},
+		{
+			name:    "directory without recursive",
+			args:    []string{"config"},
+			include: all,
+			err:     "pass --recursive",
+		},
+		{
+			name:    "glob without matches",
+			args:    []string{"*.yaml"},
+			include: all,
+			err:     "no files match",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var args []string
+			for _, arg := range tt.args {
+				args = append(args, filepath.Join(root, arg))
+			}
+
+			files, err := expandPaths(args, tt.recursive, tt.include)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Errorf("expected an error containing %q, got %v", tt.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := rel(files); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestRunWorkers(t *testing.T) {
+	files := []string{"a", "b", "c", "d", "e"}
+	var calls int32
+
+	errs := runWorkers(files, 3, func(file string) error {
+		atomic.AddInt32(&calls, 1)
+		if file == "c" {
+			return errors.New("failed")
+		}
+		return nil
+	})
+
+	if calls != int32(len(files)) {
+		t.Errorf("expected %d calls, got %d", len(files), calls)
+	}
+	for i, err := range errs {
+		if (err != nil) != (files[i] == "c") {
+			t.Errorf("expected only c to fail, got %v for %s", err, files[i])
+		}
+	}
+
+	if errs := runWorkers(nil, 4, func(string) error { return nil }); len(errs) != 0 {
+		t.Errorf("expected no errors for no files, got %v", errs)
+	}
+}
+
+func TestIsBulk(t *testing.T) {
+	root := newTree(t, "a.env")
+	file, dir := filepath.Join(root, "a.env"), root
+
+	tests := []struct {
+		args []string
+		want bool
+	}{
+		{args: []string{file}, want: false},
+		{args: []string{file, "-"}, want: false},
+		{args: []string{file, "b.env"}, want: true},
+		{args: []string{dir}, want: true},
+		{args: []string{filepath.Join(root, "*.env")}, want: true},
+		{args: []string{"--recursive", file}, want: true},
+		{args: nil, want: false},
+	}
+	for _, tt := range tests {
+		set := flag.NewFlagSet("encrypt", flag.ContinueOnError)
+		set.Bool("recursive", false, "")
+		if err := set.Parse(tt.args); err != nil {
+			t.Fatal(err)
+		}
+
+		if got := isBulk(cli.NewContext(nil, set, nil)); got != tt.want {
+			t.Errorf("isBulk(%v): expected %v, got %v", tt.args, tt.want, got)
+		}
+	}
+}
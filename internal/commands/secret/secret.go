@@ -5,9 +5,11 @@ import (
 	"github.com/urfave/cli/v2"
 	"github.com/yourusername/lockbox/internal/crypto"
 	"github.com/yourusername/lockbox/internal/git"
+	"github.com/yourusername/lockbox/internal/output"
 	"github.com/yourusername/lockbox/internal/prompt"
+	"io"
+	"os"
 	"path/filepath"
-	"strings"
 )
 
 func Command() *cli.Command {
@@ -17,30 +19,51 @@ func Command() *cli.Command {
 		Subcommands: []*cli.Command{
 			encryptCommand(),
 			decryptCommand(),
+			rekeyCommand(),
+			infoCommand(),
+			setCommand(),
+			getCommand(),
+			unsetCommand(),
+			listCommand(),
 		},
 	}
 }
 
 func encryptCommand() *cli.Command {
 	return &cli.Command{
-		Name:  "encrypt",
-		Usage: "Encrypt a file using team members' public keys",
+		Name:      "encrypt",
+		Usage:     "Encrypt files using team members' public keys",
+		ArgsUsage: "[file|dir|glob...] [-]",
+		Flags: []cli.Flag{
+			outputFlag(),
+			yesFlag(),
+			recursiveFlag(),
+			jobsFlag(),
+			allowUntrustedFlag(),
+			&cli.BoolFlag{
+				Name:  "envelope",
+				Usage: "Prefix the ciphertext with a lockbox header listing its recipients",
+			},
+			&cli.BoolFlag{
+				Name:  "armor",
+				Usage: "Write ASCII-armored ciphertext that can be pasted as text (default from .lockbox/config)",
+			},
+			&cli.BoolFlag{
+				Name:  "structured",
+				Usage: "Encrypt each value of a YAML, JSON or dotenv file, leaving keys readable",
+			},
+		},
 		Action: func(c *cli.Context) error {
-			// Get file path
-			inputPath, err := prompt.Input("Enter path to file to encrypt")
-			if err != nil {
-				return err
+			if isBulk(c) {
+				return bulkEncrypt(c)
 			}
 
-			// Confirm output path
-			defaultOutput := inputPath + ".encrypted"
-			outputPath, err := prompt.Input(fmt.Sprintf("Enter output path [%s]", defaultOutput))
+			inputPath, outputPath, err := filePaths(c, "Enter path to file to encrypt", func(inputPath string) string {
+				return inputPath + ".encrypted"
+			})
 			if err != nil {
 				return err
 			}
-			if outputPath == "" {
-				outputPath = defaultOutput
-			}
 
 			gitRoot, err := git.FindRoot()
 			if err != nil {
@@ -52,33 +75,73 @@ func encryptCommand() *cli.Command {
 				return err
 			}
 			km.SetLocalDir(filepath.Join(gitRoot, ".lockbox"))
+			km.SetPassphraseFunc(prompt.KeyPassphrase)
+			km.SetAllowUntrusted(c.Bool("allow-untrusted"))
+			km.SetEnvelope(c.Bool("envelope"))
 
-			// Show team members who will be able to decrypt
-			identities, err := km.ListTeamKeys()
+			armored, err := armorSetting(c, km)
 			if err != nil {
 				return err
 			}
+			km.SetArmor(armored)
 
-			fmt.Println("\nThe following team members will be able to decrypt:")
-			for _, identity := range identities {
-				fmt.Printf("- %s\n", identity.Name)
+			if outputPath == crypto.StdioPath {
+				if !armored && output.IsTerminal() {
+					return fmt.Errorf("refusing to write binary ciphertext to a terminal. Pass --armor or redirect it to a file or pipe")
+				}
+				output.SetOutput(os.Stderr)
 			}
 
-			// Confirm encryption
-			confirmed, err := prompt.Confirm("\nProceed with encryption?")
+			// Show team members who will be able to decrypt. Data from stdin
+			// is matched against the policy by where it is going.
+			recipientsPath := inputPath
+			if inputPath == crypto.StdioPath {
+				recipientsPath = ""
+				if outputPath != crypto.StdioPath {
+					recipientsPath = outputPath
+				}
+			}
+			members, rule, err := km.RecipientsFor(recipientsPath)
+			if err != nil {
+				return err
+			}
+
+			if rule != nil {
+				output.Infof("Matched policy rule %s", rule)
+			} else {
+				output.Infof("No policy rule matched, encrypting for the whole team")
+			}
+
+			output.Println("\nThe following team members will be able to decrypt:")
+			for _, member := range members {
+				identity := member.Identity()
+				if km.IsVerified(&identity) {
+					output.Printf("- %s [%s]\n", identity.Name, identity.Fingerprint())
+				} else {
+					output.Printf("- %s [%s] %s\n", identity.Name, identity.Fingerprint(), output.Warning("(unverified)"))
+				}
+			}
+
+			// Confirm encryption, unless stdin carries the data and can't answer
+			confirmed, err := prompt.ConfirmUnless(c.Bool("yes") || inputPath == crypto.StdioPath, "\nProceed with encryption?")
 			if err != nil {
 				return err
 			}
 			if !confirmed {
-				fmt.Println("Operation cancelled")
+				output.Println("Operation cancelled")
 				return nil
 			}
 
-			if err := km.EncryptFile(inputPath, outputPath); err != nil {
+			if c.Bool("structured") {
+				err = km.EncryptStructuredFile(inputPath, outputPath)
+			} else {
+				err = km.EncryptFile(inputPath, outputPath)
+			}
+			if err != nil {
 				return err
 			}
 
-			fmt.Printf("Successfully encrypted %s -> %s\n", inputPath, outputPath)
+			output.Printf("Successfully encrypted %s -> %s\n", displayPath(inputPath, "stdin"), displayPath(outputPath, "stdout"))
 			return nil
 		},
 	}
@@ -86,28 +149,110 @@ func encryptCommand() *cli.Command {
 
 func decryptCommand() *cli.Command {
 	return &cli.Command{
-		Name:  "decrypt",
-		Usage: "Decrypt a file using your private key",
+		Name:      "decrypt",
+		Usage:     "Decrypt files using your private key",
+		ArgsUsage: "[file|dir|glob...] [-]",
+		Flags: []cli.Flag{
+			outputFlag(),
+			recursiveFlag(),
+			jobsFlag(),
+			&cli.StringFlag{
+				Name:  "key",
+				Usage: "Decrypt with a specific personal key (pass --key= to choose from a list)",
+			},
+		},
 		Action: func(c *cli.Context) error {
-			// Get file path
-			inputPath, err := prompt.Input("Enter path to encrypted file")
+			if isBulk(c) {
+				return bulkDecrypt(c)
+			}
+
+			inputPath, outputPath, err := filePaths(c, "Enter path to encrypted file", decryptedPath)
+			if err != nil {
+				return err
+			}
+
+			if outputPath == crypto.StdioPath {
+				output.SetOutput(os.Stderr)
+			}
+
+			gitRoot, err := git.FindRoot()
 			if err != nil {
 				return err
 			}
 
-			// Get output path
-			defaultOutput := strings.TrimSuffix(inputPath, ".encrypted")
-			if defaultOutput == inputPath {
-				defaultOutput += ".decrypted"
+			km, err := crypto.NewKeyManager()
+			if err != nil {
+				return err
 			}
-			outputPath, err := prompt.Input(fmt.Sprintf("Enter output path [%s]", defaultOutput))
+			km.SetLocalDir(filepath.Join(gitRoot, ".lockbox"))
+			km.SetPassphraseFunc(prompt.KeyPassphrase)
+
+			d, err := decryptorFor(c, km)
 			if err != nil {
 				return err
 			}
-			if outputPath == "" {
-				outputPath = defaultOutput
+
+			if err := d.DecryptFile(inputPath, outputPath); err != nil {
+				return err
 			}
 
+			// Without an override every key was tried, so say which one worked
+			if !c.IsSet("key") {
+				output.Printf("Successfully decrypted %s -> %s using key %s\n", displayPath(inputPath, "stdin"), displayPath(outputPath, "stdout"), d.Matched())
+				return nil
+			}
+
+			output.Printf("Successfully decrypted %s -> %s\n", displayPath(inputPath, "stdin"), displayPath(outputPath, "stdout"))
+			return nil
+		},
+	}
+}
+
+// decryptorFor returns a Decryptor for the key chosen with --key, or for every
+// key the user has. An empty --key asks which key to use.
+func decryptorFor(c *cli.Context, km *crypto.KeyManager) (*crypto.Decryptor, error) {
+	if !c.IsSet("key") {
+		return km.NewDecryptor()
+	}
+
+	selected := c.String("key")
+	if selected == "" {
+		// Select key to use for decryption
+		identities, err := km.ListPersonalKeys()
+		if err != nil {
+			return nil, err
+		}
+
+		if len(identities) == 0 {
+			return nil, fmt.Errorf("no personal keys found. Create one with 'lockbox key add'")
+		}
+
+		var options []string
+		for _, id := range identities {
+			options = append(options, id.Name)
+		}
+
+		selected, err = prompt.SelectFromList("Select key to decrypt with", options)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return km.NewKeyDecryptor(selected)
+}
+
+func rekeyCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "rekey",
+		Usage: "Re-encrypt every secret in the repository for the current team",
+		Flags: []cli.Flag{
+			&cli.BoolFlag{
+				Name:  "dry-run",
+				Usage: "Only report which files would be re-encrypted",
+			},
+			allowUntrustedFlag(),
+		},
+		Action: func(c *cli.Context) error {
 			gitRoot, err := git.FindRoot()
 			if err != nil {
 				return err
@@ -118,33 +263,335 @@ func decryptCommand() *cli.Command {
 				return err
 			}
 			km.SetLocalDir(filepath.Join(gitRoot, ".lockbox"))
+			km.SetPassphraseFunc(prompt.KeyPassphrase)
+			km.SetAllowUntrusted(c.Bool("allow-untrusted"))
+
+			files, err := secretFiles(km, gitRoot)
+			if err != nil {
+				return err
+			}
+
+			if len(files) == 0 {
+				output.Infof("No encrypted files found")
+				return nil
+			}
+
+			d, err := km.NewDecryptor()
+			if err != nil {
+				return err
+			}
+
+			dryRun := c.Bool("dry-run")
+			var failed int
+			for _, path := range files {
+				relPath, err := filepath.Rel(gitRoot, path)
+				if err != nil {
+					relPath = path
+				}
+
+				if dryRun {
+					err = canDecrypt(d, path)
+				} else {
+					err = km.RekeyFile(path, d)
+				}
+
+				if err != nil {
+					output.Errorf("%s: %v", relPath, err)
+					failed++
+					continue
+				}
+
+				if dryRun {
+					output.Infof("%s would be re-encrypted", relPath)
+				} else {
+					output.Successf("%s re-encrypted", relPath)
+				}
+			}
+
+			if failed > 0 && dryRun {
+				return fmt.Errorf("%d of %d files could not be decrypted", failed, len(files))
+			}
+			if failed > 0 {
+				return fmt.Errorf("%d of %d files could not be re-encrypted, see the errors above", failed, len(files))
+			}
+
+			return nil
+		},
+	}
+}
+
+func infoCommand() *cli.Command {
+	return &cli.Command{
+		Name:      "info",
+		Usage:     "Show who an encrypted file was encrypted for, without decrypting it",
+		ArgsUsage: "<file>",
+		Action: func(c *cli.Context) error {
+			if c.NArg() != 1 {
+				return fmt.Errorf("usage: lockbox secret info <file>")
+			}
+			path := c.Args().First()
 
-			// Select key to use for decryption
-			identities, err := km.ListPersonalKeys()
+			env, err := crypto.ReadEnvelope(path)
 			if err != nil {
 				return err
 			}
 
-			if len(identities) == 0 {
-				return fmt.Errorf("no personal keys found. Create one with 'lockbox key add'")
+			if env != nil && output.Structured() {
+				secret := output.Secret{
+					Ciphertext:     path,
+					Recipients:     []output.Recipient{},
+					EncryptedAt:    &env.CreatedAt,
+					TeamRevision:   env.TeamRevision,
+					LockboxVersion: env.LockboxVersion,
+					Source:         "envelope",
+				}
+				for _, recipient := range env.Recipients {
+					secret.Recipients = append(secret.Recipients, output.Recipient{Name: recipient.Name, Fingerprint: recipient.Fingerprint})
+				}
+				return output.Print(secret)
 			}
 
-			var options []string
-			for _, id := range identities {
-				options = append(options, id.Name)
+			if env != nil {
+				output.Section(path)
+				output.Printf("Encrypted at:    %s\n", env.CreatedAt.Local().Format("2006-01-02 15:04:05"))
+				output.Printf("Team revision:   %d\n", env.TeamRevision)
+				output.Printf("Lockbox version: %s\n", env.LockboxVersion)
+				output.Println("Recipients:")
+				for _, recipient := range env.Recipients {
+					output.ListItem(fmt.Sprintf("%s [%s]", recipient.Name, recipient.Fingerprint))
+				}
+				return nil
+			}
+
+			if !output.Structured() {
+				output.Infof("%s has no lockbox envelope", path)
 			}
 
-			selected, err := prompt.SelectFromList("Select key to decrypt with", options)
+			// Fall back to what the manifest recorded, if the file is tracked
+			gitRoot, err := git.FindRoot()
+			if err != nil {
+				if output.Structured() {
+					return fmt.Errorf("%s has no lockbox envelope", path)
+				}
+				return nil
+			}
+
+			km, err := crypto.NewKeyManager()
+			if err != nil {
+				return err
+			}
+			km.SetLocalDir(filepath.Join(gitRoot, ".lockbox"))
+
+			entry, err := km.FindSecret(path)
 			if err != nil {
 				return err
 			}
+			if entry == nil {
+				if output.Structured() {
+					return fmt.Errorf("%s has no lockbox envelope and is not in the manifest", path)
+				}
+				return nil
+			}
 
-			if err := km.DecryptFile(inputPath, outputPath, selected); err != nil {
+			members, err := km.ListTeamMembers()
+			if err != nil {
 				return err
 			}
+			names := make(map[string]crypto.Member)
+			for _, member := range members {
+				names[member.ID] = member
+			}
+
+			if output.Structured() {
+				secret := output.Secret{
+					Plaintext:   entry.Plaintext,
+					Ciphertext:  entry.Ciphertext,
+					Recipients:  []output.Recipient{},
+					EncryptedAt: &entry.EncryptedAt,
+					EncryptedBy: entry.EncryptedBy,
+					Source:      "manifest",
+				}
+				for _, id := range entry.Recipients {
+					recipient := output.Recipient{ID: id}
+					if member, ok := names[id]; ok {
+						recipient.Name = member.Name
+						recipient.Fingerprint = member.Fingerprint()
+					}
+					secret.Recipients = append(secret.Recipients, recipient)
+				}
+				return output.Print(secret)
+			}
+
+			output.Println("\nFrom the manifest:")
+			output.Printf("Encrypted at: %s\n", entry.EncryptedAt.Local().Format("2006-01-02 15:04:05"))
+			if entry.EncryptedBy != "" {
+				output.Printf("Encrypted by: %s\n", entry.EncryptedBy)
+			}
+			output.Println("Recipients:")
+			for _, id := range entry.Recipients {
+				if member, ok := names[id]; ok {
+					output.ListItem(fmt.Sprintf("%s [%s]", member.Name, member.Fingerprint()))
+				} else {
+					output.ListItem(fmt.Sprintf("%s (no longer on the team)", entry.RecipientName(id)))
+				}
+			}
 
-			fmt.Printf("Successfully decrypted %s -> %s\n", inputPath, outputPath)
 			return nil
 		},
 	}
-} 
\ No newline at end of file
+}
+
+// secretFiles returns every secret recorded in the manifest followed by any
+// other encrypted files found in the repository
+func secretFiles(km *crypto.KeyManager, gitRoot string) ([]string, error) {
+	secrets, err := km.ListSecrets()
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool)
+	var files []string
+	for _, entry := range secrets {
+		path := km.AbsPath(entry.Ciphertext)
+		if _, err := os.Stat(path); err != nil {
+			output.Warnf("%s is in the manifest but missing", entry.Ciphertext)
+			continue
+		}
+		seen[path] = true
+		files = append(files, path)
+	}
+
+	found, err := crypto.FindEncryptedFiles(gitRoot)
+	if err != nil {
+		return nil, err
+	}
+	for _, path := range found {
+		if !seen[path] {
+			files = append(files, path)
+		}
+	}
+
+	return files, nil
+}
+
+// filePaths returns the input file from the first argument and the output
+// file from --output, or a second "-" argument for stdout, asking for whichever
+// is missing. When the input is given as an argument a missing output path
+// falls back to the default without asking; stdin defaults to stdout.
+func filePaths(c *cli.Context, message string, defaultOutput func(string) string) (string, string, error) {
+	inputPath := c.Args().First()
+	outputPath := c.String("output")
+	if c.Args().Get(1) == crypto.StdioPath {
+		if outputPath != "" {
+			return "", "", fmt.Errorf("pass either --output or -, not both")
+		}
+		outputPath = crypto.StdioPath
+	}
+
+	if inputPath != "" {
+		if outputPath == "" {
+			outputPath = defaultOutput(inputPath)
+			if inputPath == crypto.StdioPath {
+				outputPath = crypto.StdioPath
+			}
+		}
+		return inputPath, outputPath, nil
+	}
+
+	inputPath, err := prompt.Input(message)
+	if err != nil {
+		return "", "", err
+	}
+	if inputPath == "" {
+		return "", "", fmt.Errorf("no file given")
+	}
+
+	if outputPath == "" {
+		outputPath, err = prompt.Input(fmt.Sprintf("Enter output path [%s]", defaultOutput(inputPath)))
+		if err != nil {
+			return "", "", err
+		}
+		if outputPath == "" {
+			outputPath = defaultOutput(inputPath)
+		}
+	}
+
+	return inputPath, outputPath, nil
+}
+
+// armorSetting returns --armor if it was given, or else the repository
+// default from .lockbox/config. Structured files are already text, so they
+// are never armored.
+func armorSetting(c *cli.Context, km *crypto.KeyManager) (bool, error) {
+	if c.Bool("structured") {
+		if c.Bool("armor") {
+			return false, fmt.Errorf("--armor can't be used with --structured")
+		}
+		return false, nil
+	}
+
+	if c.IsSet("armor") {
+		return c.Bool("armor"), nil
+	}
+
+	config, err := km.LoadConfig()
+	if err != nil {
+		return false, err
+	}
+	return config.Armor, nil
+}
+
+// displayPath names stdin or stdout in messages instead of "-"
+func displayPath(path string, stdio string) string {
+	if path == crypto.StdioPath {
+		return stdio
+	}
+	return path
+}
+
+func outputFlag() cli.Flag {
+	return &cli.StringFlag{
+		Name:    "output",
+		Aliases: []string{"o"},
+		Usage:   "Write the result to `FILE` instead of the default path (- for stdout)",
+	}
+}
+
+func yesFlag() cli.Flag {
+	return &cli.BoolFlag{
+		Name:    "yes",
+		Aliases: []string{"y"},
+		Usage:   "Don't ask for confirmation",
+	}
+}
+
+func allowUntrustedFlag() cli.Flag {
+	return &cli.BoolFlag{
+		Name:  "allow-untrusted",
+		Usage: "Encrypt even if the team file has unsigned members or changes",
+	}
+}
+
+// canDecrypt checks that d can decrypt the file at path without keeping the plaintext
+func canDecrypt(d *crypto.Decryptor, path string) error {
+	if crypto.IsStructured(path) {
+		format, err := crypto.DetectFormat(path)
+		if err != nil {
+			return err
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("failed to read encrypted file: %w", err)
+		}
+		_, err = d.DecryptStructured(data, format)
+		return err
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to read encrypted file: %w", err)
+	}
+	defer f.Close()
+
+	return d.DecryptStream(io.Discard, f)
+}
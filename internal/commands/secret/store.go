@@ -0,0 +1,264 @@
+package secret
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/urfave/cli/v2"
+	"github.com/yourusername/lockbox/internal/crypto"
+	"github.com/yourusername/lockbox/internal/git"
+	"github.com/yourusername/lockbox/internal/output"
+	"github.com/yourusername/lockbox/internal/prompt"
+)
+
+func setCommand() *cli.Command {
+	return &cli.Command{
+		Name:      "set",
+		Usage:     "Store a secret value, read from a hidden prompt or stdin",
+		ArgsUsage: "<KEY>",
+		Flags: []cli.Flag{
+			envFlag(),
+			allowUntrustedFlag(),
+		},
+		Action: func(c *cli.Context) error {
+			key, err := secretKeyArg(c)
+			if err != nil {
+				return err
+			}
+
+			value, err := readSecretValue(key)
+			if err != nil {
+				return err
+			}
+
+			km, err := storeKeyManager()
+			if err != nil {
+				return err
+			}
+			km.SetAllowUntrusted(c.Bool("allow-untrusted"))
+
+			env := c.String("env")
+			values, err := km.LoadStore(env)
+			if err != nil {
+				return err
+			}
+
+			_, existed := values[key]
+			values[key] = value
+			if err := km.SaveStore(env, values); err != nil {
+				return err
+			}
+
+			if existed {
+				output.Successf("Updated %s in %s", key, env)
+			} else {
+				output.Successf("Added %s to %s", key, env)
+			}
+			return nil
+		},
+	}
+}
+
+func getCommand() *cli.Command {
+	return &cli.Command{
+		Name:      "get",
+		Usage:     "Print a stored secret value",
+		ArgsUsage: "<KEY>",
+		Flags: []cli.Flag{
+			envFlag(),
+		},
+		Action: func(c *cli.Context) error {
+			key, err := secretKeyArg(c)
+			if err != nil {
+				return err
+			}
+
+			km, err := storeKeyManager()
+			if err != nil {
+				return err
+			}
+
+			values, err := km.LoadStore(c.String("env"))
+			if err != nil {
+				return err
+			}
+
+			value, ok := values[key]
+			if !ok {
+				return fmt.Errorf("%s is not set in %s", key, c.String("env"))
+			}
+
+			fmt.Println(value)
+			return nil
+		},
+	}
+}
+
+func unsetCommand() *cli.Command {
+	return &cli.Command{
+		Name:      "unset",
+		Usage:     "Remove a stored secret value",
+		ArgsUsage: "<KEY>",
+		Flags: []cli.Flag{
+			envFlag(),
+			allowUntrustedFlag(),
+		},
+		Action: func(c *cli.Context) error {
+			key, err := secretKeyArg(c)
+			if err != nil {
+				return err
+			}
+
+			km, err := storeKeyManager()
+			if err != nil {
+				return err
+			}
+			km.SetAllowUntrusted(c.Bool("allow-untrusted"))
+
+			env := c.String("env")
+			values, err := km.LoadStore(env)
+			if err != nil {
+				return err
+			}
+
+			if _, ok := values[key]; !ok {
+				return fmt.Errorf("%s is not set in %s", key, env)
+			}
+
+			delete(values, key)
+			if err := km.SaveStore(env, values); err != nil {
+				return err
+			}
+
+			output.Successf("Removed %s from %s", key, env)
+			return nil
+		},
+	}
+}
+
+func listCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "list",
+		Usage: "List the keys in a secret store",
+		Flags: []cli.Flag{
+			envFlag(),
+		},
+		Action: func(c *cli.Context) error {
+			km, err := storeKeyManager()
+			if err != nil {
+				return err
+			}
+
+			env := c.String("env")
+			values, err := km.LoadStore(env)
+			if err != nil {
+				return err
+			}
+
+			if output.Structured() {
+				envs, err := km.ListStores()
+				if err != nil {
+					return err
+				}
+
+				store := output.Store{Env: env, Keys: []string{}, Environments: []string{}}
+				for key := range values {
+					store.Keys = append(store.Keys, key)
+				}
+				sort.Strings(store.Keys)
+				store.Environments = append(store.Environments, envs...)
+				return output.Print(store)
+			}
+
+			if len(values) == 0 {
+				output.Infof("No secrets stored in %s", env)
+			} else {
+				var keys []string
+				for key := range values {
+					keys = append(keys, key)
+				}
+				sort.Strings(keys)
+
+				output.Section(fmt.Sprintf("Secrets in %s", env))
+				for _, key := range keys {
+					output.ListItem(key)
+				}
+			}
+
+			envs, err := km.ListStores()
+			if err != nil {
+				return err
+			}
+
+			var others []string
+			for _, name := range envs {
+				if name != env {
+					others = append(others, name)
+				}
+			}
+			if len(others) > 0 {
+				output.Printf("\nOther environments: %s\n", strings.Join(others, ", "))
+			}
+
+			return nil
+		},
+	}
+}
+
+func envFlag() cli.Flag {
+	return &cli.StringFlag{
+		Name:  "env",
+		Usage: "Secret store to use, stored in .lockbox/secrets/<env>.age",
+		Value: crypto.DefaultEnv,
+	}
+}
+
+func storeKeyManager() (*crypto.KeyManager, error) {
+	gitRoot, err := git.FindRoot()
+	if err != nil {
+		return nil, err
+	}
+
+	km, err := crypto.NewKeyManager()
+	if err != nil {
+		return nil, err
+	}
+	km.SetLocalDir(filepath.Join(gitRoot, ".lockbox"))
+	km.SetPassphraseFunc(prompt.KeyPassphrase)
+
+	return km, nil
+}
+
+func secretKeyArg(c *cli.Context) (string, error) {
+	if c.NArg() != 1 {
+		return "", fmt.Errorf("usage: lockbox secret %s <KEY>", c.Command.Name)
+	}
+
+	key := c.Args().First()
+	if err := crypto.ValidateSecretKey(key); err != nil {
+		return "", err
+	}
+
+	return key, nil
+}
+
+// readSecretValue asks for the value of key without echoing it, or reads it
+// from stdin when that isn't a terminal. A single trailing newline is dropped
+// so 'echo value | lockbox secret set KEY' works as expected.
+func readSecretValue(key string) (string, error) {
+	if prompt.IsInteractive() {
+		return prompt.Password(fmt.Sprintf("Enter value for %s", key))
+	}
+
+	data, err := io.ReadAll(os.Stdin)
+	if err != nil {
+		return "", fmt.Errorf("failed to read value from stdin: %w", err)
+	}
+
+	value := strings.TrimSuffix(string(data), "\n")
+	return strings.TrimSuffix(value, "\r"), nil
+}
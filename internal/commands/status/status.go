@@ -0,0 +1,166 @@
+package status
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/urfave/cli/v2"
+	"github.com/yourusername/lockbox/internal/crypto"
+	"github.com/yourusername/lockbox/internal/git"
+	"github.com/yourusername/lockbox/internal/output"
+)
+
+// Command returns the status command
+func Command() *cli.Command {
+	return &cli.Command{
+		Name:  "status",
+		Usage: "Show secrets that need re-encrypting or are at risk of being committed",
+		Flags: []cli.Flag{
+			&cli.BoolFlag{
+				Name:  "check",
+				Usage: "Exit with an error if any secret needs attention (for CI)",
+			},
+		},
+		Action: func(c *cli.Context) error {
+			gitRoot, err := git.FindRoot()
+			if err != nil {
+				return err
+			}
+
+			km, err := crypto.NewKeyManager()
+			if err != nil {
+				return err
+			}
+			km.SetLocalDir(filepath.Join(gitRoot, ".lockbox"))
+
+			statuses, err := km.Status()
+			if err != nil {
+				return err
+			}
+
+			if len(statuses) == 0 && !output.Structured() {
+				output.Infof("No secrets in .lockbox/manifest")
+				return nil
+			}
+
+			// Outside git, e.g. in a deploy directory given with --repo, there
+			// is no .gitignore to check plaintext against
+			checkIgnored := git.IsWorkTree(gitRoot)
+			var unchecked bool
+
+			list := output.SecretList{Secrets: []output.Secret{}}
+			var stale, modified, exposed, missing []string
+			for _, status := range statuses {
+				entry := status.Entry
+
+				if status.Stale {
+					var changes []string
+					for _, name := range status.Added {
+						changes = append(changes, "+"+name)
+					}
+					for _, name := range status.Removed {
+						changes = append(changes, "-"+name)
+					}
+					stale = append(stale, fmt.Sprintf("%s (%s)", entry.Ciphertext, strings.Join(changes, " ")))
+				}
+
+				if status.CiphertextMissing {
+					missing = append(missing, entry.Ciphertext)
+				}
+
+				if status.PlaintextModified {
+					modified = append(modified, entry.Plaintext)
+				}
+
+				plaintextExposed := false
+				if status.PlaintextExists && !checkIgnored {
+					unchecked = true
+				} else if status.PlaintextExists {
+					ignored, err := git.IsIgnored(gitRoot, entry.Plaintext)
+					if err != nil {
+						return err
+					}
+					if !ignored {
+						exposed = append(exposed, entry.Plaintext)
+						plaintextExposed = true
+					}
+				}
+
+				if output.Structured() {
+					list.Secrets = append(list.Secrets, secretSchema(status, plaintextExposed))
+				}
+			}
+
+			if unchecked {
+				output.Infof("%s is not a git working tree, so plaintext files were not checked against .gitignore", gitRoot)
+			}
+
+			problems := len(stale) + len(modified) + len(exposed) + len(missing)
+			if output.Structured() {
+				if err := output.Print(list); err != nil {
+					return err
+				}
+				if problems > 0 && c.Bool("check") {
+					return fmt.Errorf("%d secret(s) need attention", problems)
+				}
+				return nil
+			}
+
+			printGroup("Stale secrets (run 'lockbox secret rekey')", stale)
+			printGroup("Plaintext changed since last encryption (run 'lockbox secret encrypt')", modified)
+			printGroup("Plaintext not in .gitignore", exposed)
+			printGroup("Encrypted file missing", missing)
+
+			if problems == 0 {
+				output.Successf("All %d secrets are up to date", len(statuses))
+				return nil
+			}
+
+			if c.Bool("check") {
+				return fmt.Errorf("%d secret(s) need attention", problems)
+			}
+
+			return nil
+		},
+	}
+}
+
+// secretSchema converts a secret's status for --output json and yaml
+func secretSchema(status crypto.SecretStatus, exposed bool) output.Secret {
+	entry := status.Entry
+	encryptedAt := entry.EncryptedAt
+
+	secret := output.Secret{
+		Plaintext:   entry.Plaintext,
+		Ciphertext:  entry.Ciphertext,
+		Recipients:  []output.Recipient{},
+		EncryptedAt: &encryptedAt,
+		EncryptedBy: entry.EncryptedBy,
+		Source:      "manifest",
+		Status: &output.Status{
+			Stale:             status.Stale,
+			Added:             status.Added,
+			Removed:           status.Removed,
+			CiphertextMissing: status.CiphertextMissing,
+			PlaintextModified: status.PlaintextModified,
+			PlaintextExposed:  exposed,
+		},
+	}
+	for _, id := range entry.Recipients {
+		secret.Recipients = append(secret.Recipients, output.Recipient{ID: id, Name: entry.RecipientName(id)})
+	}
+
+	return secret
+}
+
+func printGroup(title string, paths []string) {
+	if len(paths) == 0 {
+		return
+	}
+
+	output.Section(title)
+	for _, path := range paths {
+		output.ListItem(path)
+	}
+}
@@ -4,10 +4,14 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
 
 	"github.com/urfave/cli/v2"
 	"github.com/yourusername/lockbox/internal/crypto"
 	"github.com/yourusername/lockbox/internal/git"
+	"github.com/yourusername/lockbox/internal/output"
 	"github.com/yourusername/lockbox/internal/prompt"
 )
 
@@ -22,6 +26,11 @@ func Command() *cli.Command {
 			listCommand(),
 			initCommand(),
 			showKeyCommand(),
+			migrateCommand(),
+			signCommand(),
+			thresholdCommand(),
+			verifyCommand(),
+			groupCommand(),
 		},
 	}
 }
@@ -36,6 +45,10 @@ func initCommand() *cli.Command {
 				Usage:    "Your name",
 				Required: true,
 			},
+			&cli.StringFlag{
+				Name:  "email",
+				Usage: "Your email address",
+			},
 		},
 		Action: func(c *cli.Context) error {
 			gitRoot, err := git.FindRoot()
@@ -48,6 +61,7 @@ func initCommand() *cli.Command {
 				return err
 			}
 			km.SetLocalDir(filepath.Join(gitRoot, ".lockbox"))
+			km.SetPassphraseFunc(prompt.KeyPassphrase)
 
 			// Check if user already has a key
 			if identity, err := km.LoadPrivateKey(); err != nil {
@@ -62,17 +76,23 @@ func initCommand() *cli.Command {
 				return err
 			}
 
-			// Save private key
-			if err := km.SavePrivateKey(identity); err != nil {
+			// Add public key to team
+			_, err = km.AddTeamMember(&crypto.Member{
+				Name:      identity.Name,
+				Email:     c.String("email"),
+				PublicKey: identity.PublicKey,
+				AddedBy:   identity.Name,
+			})
+			if err != nil {
 				return err
 			}
 
-			// Add public key to team
-			if err := km.SaveTeamKey(identity); err != nil {
+			// Save private key
+			if err := km.SavePrivateKey(identity); err != nil {
 				return err
 			}
 
-			fmt.Printf("Initialized identity for %s\n", identity.Name)
+			output.Printf("Initialized identity for %s\n", identity.Name)
 			return nil
 		},
 	}
@@ -82,6 +102,32 @@ func addCommand() *cli.Command {
 	return &cli.Command{
 		Name:  "add",
 		Usage: "Add a team member's public key",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:  "name",
+				Usage: "Name of the new member",
+			},
+			&cli.StringFlag{
+				Name:  "email",
+				Usage: "Email of the new member",
+			},
+			&cli.StringFlag{
+				Name:  "key",
+				Usage: "Add this age or SSH public key",
+			},
+			&cli.StringFlag{
+				Name:  "key-file",
+				Usage: "Add the public key in `FILE`",
+			},
+			&cli.StringFlag{
+				Name:  "personal",
+				Usage: "Add one of your personal keys by `NAME`",
+			},
+			&cli.StringFlag{
+				Name:  "authorized-keys",
+				Usage: "Add every key in an SSH authorized_keys `FILE`",
+			},
+		},
 		Action: func(c *cli.Context) error {
 			gitRoot, err := git.FindRoot()
 			if err != nil {
@@ -93,14 +139,27 @@ func addCommand() *cli.Command {
 				return err
 			}
 			km.SetLocalDir(filepath.Join(gitRoot, ".lockbox"))
-
-			// Ask if adding from personal keys or file
-			source, err := prompt.SelectFromList(
-				"Add key from",
-				[]string{"Personal keys", "Public key file"},
-			)
-			if err != nil {
-				return err
+			km.SetPassphraseFunc(prompt.KeyPassphrase)
+
+			// Ask if adding from personal keys or file, unless a flag says so
+			var source string
+			interactive := false
+			switch {
+			case c.IsSet("personal"):
+				source = "Personal keys"
+			case c.IsSet("authorized-keys"):
+				source = "SSH authorized_keys file"
+			case c.IsSet("key"), c.IsSet("key-file"):
+				source = "Public key file"
+			default:
+				interactive = true
+				source, err = prompt.SelectFromList(
+					"Add key from",
+					[]string{"Personal keys", "Public key file", "SSH authorized_keys file"},
+				)
+				if err != nil {
+					return err
+				}
 			}
 
 			var identity *crypto.Identity
@@ -117,21 +176,38 @@ func addCommand() *cli.Command {
 				var options []string
 				idMap := make(map[string]crypto.Identity)
 				for _, id := range identities {
-					options = append(options, fmt.Sprintf("%s (%s)", id.Name, id.PublicKey))
+					if id.Name == c.String("personal") {
+						identity = &id
+						break
+					}
+					options = append(options, fmt.Sprintf("%s [%s]", id.Name, id.Fingerprint()))
 					idMap[options[len(options)-1]] = id
 				}
 
-				selected, err := prompt.SelectFromList("Select a key to add", options)
-				if err != nil {
-					return err
+				if identity == nil {
+					if c.IsSet("personal") {
+						return fmt.Errorf("no personal key named %s", c.String("personal"))
+					}
+
+					selected, err := prompt.SelectFromList("Select a key to add", options)
+					if err != nil {
+						return err
+					}
+
+					id := idMap[selected]
+					identity = &id
 				}
 
-				id := idMap[selected]
-				identity = &id
-			} else {
-				filePath, err := prompt.Input("Enter path to public key file")
-				if err != nil {
-					return err
+				if c.IsSet("name") {
+					identity.Name = c.String("name")
+				}
+			} else if source == "SSH authorized_keys file" {
+				filePath := c.String("authorized-keys")
+				if filePath == "" {
+					filePath, err = prompt.Input("Enter path to authorized_keys file")
+					if err != nil {
+						return err
+					}
 				}
 
 				data, err := os.ReadFile(filePath)
@@ -139,22 +215,87 @@ func addCommand() *cli.Command {
 					return fmt.Errorf("failed to read key file: %w", err)
 				}
 
-				name, err := prompt.Input("Enter name for this key")
+				identities, err := crypto.ParseAuthorizedKeys(data)
 				if err != nil {
 					return err
 				}
 
+				if len(identities) == 0 {
+					return fmt.Errorf("no SSH keys found in %s", filePath)
+				}
+
+				for _, id := range identities {
+					if id.Name == "" {
+						id.Name, err = prompt.Input(fmt.Sprintf("Enter name for %s", id.PublicKey))
+						if err != nil {
+							return err
+						}
+					}
+
+					member := &crypto.Member{Name: id.Name, PublicKey: id.PublicKey}
+					if strings.Contains(id.Name, "@") {
+						member.Email = id.Name
+					}
+
+					if _, err := km.AddTeamMember(member); err != nil {
+						return err
+					}
+
+					output.Printf("Added %s to the team\n", id.Name)
+				}
+
+				return nil
+			} else {
+				publicKey := c.String("key")
+				if publicKey == "" {
+					filePath := c.String("key-file")
+					if filePath == "" {
+						filePath, err = prompt.Input("Enter path to public key file")
+						if err != nil {
+							return err
+						}
+					}
+
+					data, err := os.ReadFile(filePath)
+					if err != nil {
+						return fmt.Errorf("failed to read key file: %w", err)
+					}
+					publicKey = string(data)
+				}
+
+				name := c.String("name")
+				if name == "" {
+					name, err = prompt.Input("Enter name for this key")
+					if err != nil {
+						return err
+					}
+				}
+
 				identity = &crypto.Identity{
 					Name:      name,
-					PublicKey: string(data),
+					PublicKey: publicKey,
 				}
 			}
 
-			if err := km.SaveTeamKey(identity); err != nil {
+			// Only ask for the optional email in the fully interactive flow
+			email := c.String("email")
+			if interactive && !c.IsSet("email") {
+				email, err = prompt.Input("Enter email for this member (optional)")
+				if err != nil {
+					return err
+				}
+			}
+
+			_, err = km.AddTeamMember(&crypto.Member{
+				Name:      identity.Name,
+				Email:     email,
+				PublicKey: identity.PublicKey,
+			})
+			if err != nil {
 				return err
 			}
 
-			fmt.Printf("Added %s to the team\n", identity.Name)
+			output.Printf("Added %s to the team\n", identity.Name)
 			return nil
 		},
 	}
@@ -162,8 +303,12 @@ func addCommand() *cli.Command {
 
 func removeCommand() *cli.Command {
 	return &cli.Command{
-		Name:  "remove",
-		Usage: "Remove a team member",
+		Name:      "remove",
+		Usage:     "Remove a team member",
+		ArgsUsage: "[member]",
+		Flags: []cli.Flag{
+			yesFlag(),
+		},
 		Action: func(c *cli.Context) error {
 			gitRoot, err := git.FindRoot()
 			if err != nil {
@@ -175,42 +320,53 @@ func removeCommand() *cli.Command {
 				return err
 			}
 			km.SetLocalDir(filepath.Join(gitRoot, ".lockbox"))
+			km.SetPassphraseFunc(prompt.KeyPassphrase)
 
 			// List team members
-			identities, err := km.ListTeamKeys()
+			members, err := km.ListTeamMembers()
 			if err != nil {
 				return err
 			}
 
-			if len(identities) == 0 {
+			if len(members) == 0 {
 				return fmt.Errorf("no team members found")
 			}
 
-			// Create options for selection
-			var options []string
-			idMap := make(map[string]crypto.Identity)
-			for _, id := range identities {
-				display := fmt.Sprintf("%s (%s)", id.Name, id.PublicKey)
-				options = append(options, display)
-				idMap[display] = id
-			}
+			var identity crypto.Identity
+			if query := c.Args().First(); query != "" {
+				member, err := findMember(members, query)
+				if err != nil {
+					return err
+				}
+				identity = member.Identity()
+			} else {
+				// Create options for selection
+				var options []string
+				idMap := make(map[string]crypto.Identity)
+				for _, member := range members {
+					id := member.Identity()
+					display := fmt.Sprintf("%s [%s]", id.Name, id.Fingerprint())
+					options = append(options, display)
+					idMap[display] = id
+				}
 
-			// Select member to remove
-			selected, err := prompt.SelectFromList("Select team member to remove", options)
-			if err != nil {
-				return err
-			}
+				// Select member to remove
+				selected, err := prompt.SelectFromList("Select team member to remove", options)
+				if err != nil {
+					return err
+				}
 
-			identity := idMap[selected]
+				identity = idMap[selected]
+			}
 
 			// Confirm removal
-			confirmed, err := prompt.Confirm(fmt.Sprintf("Are you sure you want to remove %s from the team?", identity.Name))
+			confirmed, err := prompt.ConfirmUnless(c.Bool("yes"), fmt.Sprintf("Are you sure you want to remove %s from the team?", identity.Name))
 			if err != nil {
 				return err
 			}
 
 			if !confirmed {
-				fmt.Println("Operation cancelled")
+				output.Println("Operation cancelled")
 				return nil
 			}
 
@@ -218,7 +374,7 @@ func removeCommand() *cli.Command {
 				return err
 			}
 
-			fmt.Printf("Successfully removed %s from the team\n", identity.Name)
+			output.Printf("Successfully removed %s from the team\n", identity.Name)
 			return nil
 		},
 	}
@@ -240,19 +396,55 @@ func listCommand() *cli.Command {
 			}
 			km.SetLocalDir(filepath.Join(gitRoot, ".lockbox"))
 
-			identities, err := km.ListTeamKeys()
+			members, err := km.ListTeamMembers()
 			if err != nil {
 				return err
 			}
 
-			if len(identities) == 0 {
-				fmt.Println("No team members found")
+			if len(members) == 0 && !output.Structured() {
+				output.Println("No team members found")
 				return nil
 			}
 
-			fmt.Println("Team members:")
-			for _, identity := range identities {
-				fmt.Printf("- %s: %s\n", identity.Name, identity.PublicKey)
+			report, err := km.VerifyTeam()
+			if err != nil {
+				return err
+			}
+
+			if output.Structured() {
+				list := output.TeamList{Members: []output.Member{}, Problems: []string{}}
+				for i := range members {
+					list.Members = append(list.Members, memberSchema(km, &members[i], report))
+				}
+				if len(members) > 0 {
+					list.Problems = append(list.Problems, report.Problems...)
+				}
+				return output.Print(list)
+			}
+
+			output.Println("Team members:")
+			for _, member := range members {
+				name := member.Name
+				if member.Email != "" {
+					name = fmt.Sprintf("%s <%s>", member.Name, member.Email)
+				}
+				status := output.SuccessIcon()
+				if !report.Trusted[member.ID] {
+					status = output.WarningIcon()
+				}
+				if len(member.Tags) > 0 {
+					name = fmt.Sprintf("%s (%s)", name, strings.Join(member.Tags, ", "))
+				}
+				verified := ""
+				if !km.IsVerified(&crypto.Identity{Name: member.Name, PublicKey: member.PublicKey}) {
+					verified = " (unverified)"
+				}
+				output.Printf("%s %s [%s] %s%s\n", status, name, member.Type, member.Fingerprint(), verified)
+				output.Printf("    %s\n", member.PublicKey)
+			}
+
+			for _, problem := range report.Problems {
+				output.Warnf("%s", problem)
 			}
 
 			return nil
@@ -284,8 +476,464 @@ func showKeyCommand() *cli.Command {
 				return fmt.Errorf("no identity found. Run 'lockbox team init' first")
 			}
 
-			fmt.Printf("Your public key:\n%s\n", identity.PublicKey)
+			if output.Structured() {
+				return output.Print(output.Key{
+					Name:        identity.Name,
+					Key:         identity.PublicKey,
+					Fingerprint: identity.Fingerprint(),
+					Words:       identity.FingerprintWords(),
+				})
+			}
+
+			output.Printf("Your public key:\n%s\n", identity.PublicKey)
+			output.Printf("Fingerprint: %s\n", identity.Fingerprint())
+			output.Printf("Words: %s\n", identity.FingerprintWords())
+			return nil
+		},
+	}
+}
+
+func migrateCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "migrate",
+		Usage: "Convert the legacy team-keys.txt into the structured team.json format",
+		Action: func(c *cli.Context) error {
+			gitRoot, err := git.FindRoot()
+			if err != nil {
+				return err
+			}
+
+			km, err := crypto.NewKeyManager()
+			if err != nil {
+				return err
+			}
+			km.SetLocalDir(filepath.Join(gitRoot, ".lockbox"))
+
+			count, err := km.MigrateTeamFile()
+			if err != nil {
+				return err
+			}
+
+			output.Printf("Migrated %d team members to .lockbox/team.json\n", count)
+			return nil
+		},
+	}
+}
+
+func signCommand() *cli.Command {
+	return &cli.Command{
+		Name:      "sign",
+		Usage:     "Sign a team member's entry to approve them as a recipient",
+		ArgsUsage: "[member]",
+		Flags: []cli.Flag{
+			yesFlag(),
+		},
+		Action: func(c *cli.Context) error {
+			gitRoot, err := git.FindRoot()
+			if err != nil {
+				return err
+			}
+
+			km, err := crypto.NewKeyManager()
+			if err != nil {
+				return err
+			}
+			km.SetLocalDir(filepath.Join(gitRoot, ".lockbox"))
+			km.SetPassphraseFunc(prompt.KeyPassphrase)
+
+			report, err := km.VerifyTeam()
+			if err != nil {
+				return err
+			}
+
+			members, err := km.ListTeamMembers()
+			if err != nil {
+				return err
+			}
+
+			if len(members) == 0 {
+				return fmt.Errorf("no team members found")
+			}
+
+			var member *crypto.Member
+			if query := c.Args().First(); query != "" {
+				member, err = findMember(members, query)
+				if err != nil {
+					return err
+				}
+			} else {
+				// Members that still need signatures are listed first
+				var options []string
+				idMap := make(map[string]*crypto.Member)
+				for _, trusted := range []bool{false, true} {
+					for i := range members {
+						if report.Trusted[members[i].ID] != trusted {
+							continue
+						}
+						display := fmt.Sprintf("%s [%s]", members[i].Name, members[i].Fingerprint())
+						if !trusted {
+							display += " - pending"
+						}
+						options = append(options, display)
+						idMap[display] = &members[i]
+					}
+				}
+
+				selected, err := prompt.SelectFromList("Select team member to sign", options)
+				if err != nil {
+					return err
+				}
+
+				member = idMap[selected]
+			}
+
+			confirmed, err := prompt.ConfirmUnless(c.Bool("yes"), fmt.Sprintf("Have you confirmed that fingerprint %s belongs to %s?", member.Fingerprint(), member.Name))
+			if err != nil {
+				return err
+			}
+
+			if !confirmed {
+				output.Println("Operation cancelled")
+				return nil
+			}
+
+			if err := km.SignTeamMember(member.ID); err != nil {
+				return err
+			}
+
+			output.Successf("Signed %s", member.Name)
+			return nil
+		},
+	}
+}
+
+func thresholdCommand() *cli.Command {
+	return &cli.Command{
+		Name:      "threshold",
+		Usage:     "Set how many members must sign a new member before they are trusted",
+		ArgsUsage: "<count>",
+		Action: func(c *cli.Context) error {
+			threshold, err := strconv.Atoi(c.Args().First())
+			if err != nil {
+				return fmt.Errorf("usage: lockbox team threshold <count>")
+			}
+
+			gitRoot, err := git.FindRoot()
+			if err != nil {
+				return err
+			}
+
+			km, err := crypto.NewKeyManager()
+			if err != nil {
+				return err
+			}
+			km.SetLocalDir(filepath.Join(gitRoot, ".lockbox"))
+			km.SetPassphraseFunc(prompt.KeyPassphrase)
+
+			if err := km.SetThreshold(threshold); err != nil {
+				return err
+			}
+
+			output.Successf("New members now need %d signature(s) to be trusted", threshold)
+			return nil
+		},
+	}
+}
+
+func verifyCommand() *cli.Command {
+	return &cli.Command{
+		Name:      "verify",
+		Usage:     "Compare fingerprints with a team member and record them as verified",
+		ArgsUsage: "[member]",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:  "fingerprint",
+				Usage: "Check the member's key against this fingerprint instead of asking",
+			},
+			&cli.BoolFlag{
+				Name:  "sign",
+				Usage: "Sign the member's entry if they are not yet trusted",
+			},
+		},
+		Action: func(c *cli.Context) error {
+			gitRoot, err := git.FindRoot()
+			if err != nil {
+				return err
+			}
+
+			km, err := crypto.NewKeyManager()
+			if err != nil {
+				return err
+			}
+			km.SetLocalDir(filepath.Join(gitRoot, ".lockbox"))
+			km.SetPassphraseFunc(prompt.KeyPassphrase)
+
+			members, err := km.ListTeamMembers()
+			if err != nil {
+				return err
+			}
+
+			if len(members) == 0 {
+				return fmt.Errorf("no team members found")
+			}
+
+			var member *crypto.Member
+			if query := c.Args().First(); query != "" {
+				member, err = findMember(members, query)
+				if err != nil {
+					return err
+				}
+			} else {
+				var options []string
+				idMap := make(map[string]*crypto.Member)
+				for i := range members {
+					display := fmt.Sprintf("%s [%s]", members[i].Name, members[i].Fingerprint())
+					options = append(options, display)
+					idMap[display] = &members[i]
+				}
+
+				selected, err := prompt.SelectFromList("Select team member to verify", options)
+				if err != nil {
+					return err
+				}
+				member = idMap[selected]
+			}
+
+			identity := member.Identity()
+
+			// Step 1: they check our fingerprint
+			own, err := km.OwnMember()
+			if err != nil {
+				return err
+			}
+			if own != nil {
+				ownIdentity := own.Identity()
+				output.Section("Step 1: read your fingerprint to " + member.Name)
+				output.Printf("  %s\n  %s\n", ownIdentity.Fingerprint(), ownIdentity.FingerprintWords())
+				output.Printf("\nThey can check it with 'lockbox team verify %s'.\n", own.Name)
+			}
+
+			// Step 2: we check theirs
+			output.Section("Step 2: ask " + member.Name + " to read their fingerprint")
+			output.Println("They can find it with 'lockbox team show-key'. It should be:")
+			output.Printf("  %s\n  %s\n\n", identity.Fingerprint(), identity.FingerprintWords())
+
+			var matches bool
+			if c.IsSet("fingerprint") {
+				matches = normalizeFingerprint(c.String("fingerprint")) == normalizeFingerprint(identity.Fingerprint())
+			} else {
+				matches, err = prompt.Confirm(fmt.Sprintf("Does the fingerprint %s read to you match?", member.Name))
+				if err != nil {
+					return err
+				}
+			}
+
+			if !matches {
+				output.Errorf("Fingerprints don't match. Do not encrypt secrets for this key until you find out why")
+				return fmt.Errorf("verification of %s failed", member.Name)
+			}
+
+			if err := km.MarkVerified(&identity); err != nil {
+				return err
+			}
+			output.Successf("Verified %s", member.Name)
+
+			// Offer to approve a pending member now that we know the key is theirs
+			report, err := km.VerifyTeam()
+			if err != nil {
+				return err
+			}
+			if own == nil || report.Trusted[member.ID] {
+				return nil
+			}
+
+			sign := c.Bool("sign")
+			if !sign && prompt.IsInteractive() {
+				sign, err = prompt.Confirm(fmt.Sprintf("%s is not yet trusted on this team. Sign their entry now?", member.Name))
+				if err != nil {
+					return err
+				}
+			}
+			if !sign {
+				return nil
+			}
+
+			if err := km.SignTeamMember(member.ID); err != nil {
+				return err
+			}
+
+			output.Successf("Signed %s", member.Name)
 			return nil
 		},
 	}
 }
+
+func groupCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "group",
+		Usage: "Manage recipient groups used by .lockbox/policy",
+		Subcommands: []*cli.Command{
+			{
+				Name:      "add",
+				Usage:     "Add a team member to a group",
+				ArgsUsage: "<group> <member>",
+				Action: func(c *cli.Context) error {
+					return changeGroup(c, true)
+				},
+			},
+			{
+				Name:      "remove",
+				Usage:     "Remove a team member from a group",
+				ArgsUsage: "<group> <member>",
+				Action: func(c *cli.Context) error {
+					return changeGroup(c, false)
+				},
+			},
+			{
+				Name:  "list",
+				Usage: "List groups and their members",
+				Action: func(c *cli.Context) error {
+					gitRoot, err := git.FindRoot()
+					if err != nil {
+						return err
+					}
+
+					km, err := crypto.NewKeyManager()
+					if err != nil {
+						return err
+					}
+					km.SetLocalDir(filepath.Join(gitRoot, ".lockbox"))
+
+					team, err := km.LoadTeam()
+					if err != nil {
+						return err
+					}
+
+					if len(team.Groups) == 0 && !output.Structured() {
+						output.Println("No groups found")
+						return nil
+					}
+
+					var groups []string
+					for group := range team.Groups {
+						groups = append(groups, group)
+					}
+					sort.Strings(groups)
+
+					if output.Structured() {
+						list := output.GroupList{Groups: []output.Group{}}
+						for _, group := range groups {
+							g := output.Group{Name: group, Members: []output.Recipient{}}
+							for _, id := range team.Groups[group] {
+								recipient := output.Recipient{ID: id}
+								if member, err := findMember(team.Members, id); err == nil {
+									recipient.Name = member.Name
+									recipient.Fingerprint = member.Fingerprint()
+								}
+								g.Members = append(g.Members, recipient)
+							}
+							list.Groups = append(list.Groups, g)
+						}
+						return output.Print(list)
+					}
+
+					for _, group := range groups {
+						output.Section(group)
+						for _, id := range team.Groups[group] {
+							member, err := findMember(team.Members, id)
+							if err != nil {
+								output.ListItem(id + " (not a member)")
+								continue
+							}
+							output.ListItem(fmt.Sprintf("%s [%s]", member.Name, member.Fingerprint()))
+						}
+					}
+
+					return nil
+				},
+			},
+		},
+	}
+}
+
+func changeGroup(c *cli.Context, add bool) error {
+	if c.NArg() != 2 {
+		return fmt.Errorf("usage: lockbox team group %s <group> <member>", c.Command.Name)
+	}
+	group := c.Args().Get(0)
+
+	gitRoot, err := git.FindRoot()
+	if err != nil {
+		return err
+	}
+
+	km, err := crypto.NewKeyManager()
+	if err != nil {
+		return err
+	}
+	km.SetLocalDir(filepath.Join(gitRoot, ".lockbox"))
+	km.SetPassphraseFunc(prompt.KeyPassphrase)
+
+	members, err := km.ListTeamMembers()
+	if err != nil {
+		return err
+	}
+
+	member, err := findMember(members, c.Args().Get(1))
+	if err != nil {
+		return err
+	}
+
+	if add {
+		if err := km.AddToGroup(group, member.ID); err != nil {
+			return err
+		}
+		output.Successf("Added %s to group %s", member.Name, group)
+		return nil
+	}
+
+	if err := km.RemoveFromGroup(group, member.ID); err != nil {
+		return err
+	}
+	output.Successf("Removed %s from group %s", member.Name, group)
+	return nil
+}
+
+// findMember looks up a team member by ID or name
+func findMember(members []crypto.Member, query string) (*crypto.Member, error) {
+	for i := range members {
+		if members[i].ID == query || members[i].Name == query {
+			return &members[i], nil
+		}
+	}
+	return nil, fmt.Errorf("no team member named %s", query)
+}
+
+// memberSchema converts a member for --output json and yaml
+func memberSchema(km *crypto.KeyManager, member *crypto.Member, report *crypto.TrustReport) output.Member {
+	identity := member.Identity()
+	return output.Member{
+		ID:          member.ID,
+		Name:        member.Name,
+		Email:       member.Email,
+		Type:        member.Type,
+		Key:         member.PublicKey,
+		Fingerprint: member.Fingerprint(),
+		Tags:        member.Tags,
+		Trusted:     report.Trusted[member.ID],
+		Verified:    km.IsVerified(&identity),
+	}
+}
+
+// normalizeFingerprint drops the grouping and case of a typed fingerprint
+func normalizeFingerprint(fingerprint string) string {
+	return strings.ToUpper(strings.Join(strings.Fields(strings.ReplaceAll(fingerprint, ":", " ")), ""))
+}
+
+func yesFlag() cli.Flag {
+	return &cli.BoolFlag{
+		Name:    "yes",
+		Aliases: []string{"y"},
+		Usage:   "Don't ask for confirmation",
+	}
+}
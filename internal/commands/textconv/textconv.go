@@ -0,0 +1,128 @@
+package textconv
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/urfave/cli/v2"
+	"github.com/yourusername/lockbox/internal/crypto"
+	"github.com/yourusername/lockbox/internal/git"
+	"github.com/yourusername/lockbox/internal/output"
+)
+
+func Command() *cli.Command {
+	return &cli.Command{
+		Name:      "git-textconv",
+		Usage:     "Print an encrypted file decrypted, for git diff (run by git)",
+		ArgsUsage: "<file>",
+		Flags: []cli.Flag{
+			&cli.BoolFlag{
+				Name:  "install",
+				Usage: "Configure diff.lockbox.textconv and mark *.encrypted files in .gitattributes",
+			},
+		},
+		Action: func(c *cli.Context) error {
+			if c.Bool("install") {
+				return install()
+			}
+
+			if c.NArg() != 1 {
+				return fmt.Errorf("usage: lockbox git-textconv <file>")
+			}
+
+			// stdout is what git diffs
+			output.SetOutput(os.Stderr)
+
+			path := c.Args().First()
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return fmt.Errorf("failed to read %s: %w", path, err)
+			}
+
+			encrypted, err := crypto.IsEncrypted(path)
+			if err != nil {
+				return err
+			}
+			if !encrypted && !crypto.IsStructured(path) {
+				_, err := os.Stdout.Write(data)
+				return err
+			}
+
+			plaintext, err := decrypt(path)
+			if err != nil {
+				// Diffs shouldn't fail for people who aren't recipients
+				fmt.Print(placeholder(path, data, err))
+				return nil
+			}
+
+			_, err = os.Stdout.Write(plaintext)
+			return err
+		},
+	}
+}
+
+func decrypt(path string) ([]byte, error) {
+	gitRoot, err := git.FindRoot()
+	if err != nil {
+		return nil, err
+	}
+
+	km, err := crypto.NewKeyManager()
+	if err != nil {
+		return nil, err
+	}
+	km.SetLocalDir(filepath.Join(gitRoot, ".lockbox"))
+
+	d, err := km.NewDecryptor()
+	if err != nil {
+		return nil, err
+	}
+
+	return d.ReadFile(path)
+}
+
+// placeholder stands in for a file that can't be decrypted. It changes with
+// the ciphertext, so the diff still shows that the secret changed.
+func placeholder(path string, data []byte, reason error) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "[lockbox: encrypted, %s]\n", reason)
+
+	if env, err := crypto.ReadEnvelope(path); err == nil && env != nil {
+		var names []string
+		for _, recipient := range env.Recipients {
+			names = append(names, recipient.Name)
+		}
+		fmt.Fprintf(&b, "[lockbox: encrypted for %s]\n", strings.Join(names, ", "))
+	}
+
+	sum := sha256.Sum256(data)
+	fmt.Fprintf(&b, "[lockbox: %d bytes, sha256 %x]\n", len(data), sum[:8])
+	return b.String()
+}
+
+func install() error {
+	gitRoot, err := git.FindRoot()
+	if err != nil {
+		return err
+	}
+
+	// Don't set diff.lockbox.cachetextconv: git would store the decrypted
+	// text in the object database
+	if err := git.SetConfig(gitRoot, "diff.lockbox.textconv", "lockbox git-textconv"); err != nil {
+		return err
+	}
+	output.Successf("Configured diff.lockbox.textconv in .git/config")
+
+	added, err := git.AddAttributes(gitRoot, []string{"*.encrypted"}, "diff=lockbox")
+	if err != nil {
+		return err
+	}
+	for _, pattern := range added {
+		output.Successf("Added %s to .gitattributes", pattern)
+	}
+
+	return nil
+}
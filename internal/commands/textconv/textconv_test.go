@@ -0,0 +1,42 @@
+package textconv
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPlaceholder(t *testing.T) {
+	dir := t.TempDir()
+	reason := errors.New("no identity matched")
+
+	path := filepath.Join(dir, "prod.env.encrypted")
+	data := []byte("lockbox-envelope/v1\n" + `{"recipients":[{"name":"alice"},{"name":"bob"}]}` + "\nage-encryption.org/v1\n")
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	text := placeholder(path, data, reason)
+	for _, want := range []string{"no identity matched", "encrypted for alice, bob", "bytes, sha256"} {
+		if !strings.Contains(text, want) {
+			t.Errorf("expected the placeholder to contain %q, got\n%s", want, text)
+		}
+	}
+
+	// The placeholder changes with the ciphertext, so diffs still show a change
+	changed := append(append([]byte(nil), data...), 'x')
+	if placeholder(path, changed, reason) == text {
+		t.Error("expected a different placeholder for different ciphertext")
+	}
+
+	// Without an envelope there are no recipients to name
+	plain := filepath.Join(dir, "plain.encrypted")
+	if err := os.WriteFile(plain, []byte("age-encryption.org/v1\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if text := placeholder(plain, data, reason); strings.Contains(text, "encrypted for") {
+		t.Errorf("expected no recipients without an envelope, got\n%s", text)
+	}
+}
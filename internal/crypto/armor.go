@@ -0,0 +1,50 @@
+package crypto
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+
+	"filippo.io/age/armor"
+)
+
+// armorPeek is how far into the input isArmored looks for the armor header,
+// leaving room for blank lines left over from pasting
+const armorPeek = 1024
+
+// SetArmor makes Encrypt write the age payload as PEM-style ASCII armor, which
+// can be pasted into tickets, chat or YAML
+func (km *KeyManager) SetArmor(armored bool) {
+	km.armor = armored
+}
+
+// isArmored reports whether r continues with an ASCII-armored age file,
+// without consuming anything
+func isArmored(r *bufio.Reader) bool {
+	data, _ := r.Peek(armorPeek)
+	return hasArmorHeader(data)
+}
+
+// hasArmorHeader reports whether data starts with the armor header, after any
+// blank lines. It is the one check for armor, so every command that decrypts
+// armored files also finds them.
+func hasArmorHeader(data []byte) bool {
+	return bytes.HasPrefix(bytes.TrimLeft(data, " \t\r\n"), []byte(armor.Header))
+}
+
+// armoredWriter finalizes the age payload before the armor that wraps it
+type armoredWriter struct {
+	io.WriteCloser
+	armor io.WriteCloser
+}
+
+func (w *armoredWriter) Close() error {
+	if err := w.WriteCloser.Close(); err != nil {
+		return err
+	}
+	if err := w.armor.Close(); err != nil {
+		return fmt.Errorf("failed to finalize armor: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+package crypto
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"filippo.io/age/armor"
+)
+
+func TestHasArmorHeader(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want bool
+	}{
+		{name: "armored", data: armor.Header + "\n...", want: true},
+		{name: "pasted with blank lines", data: "\n\r\n  \t" + armor.Header + "\n", want: true},
+		{name: "binary age", data: string(ageMagic), want: false},
+		{name: "text mentioning the header", data: "see " + armor.Header, want: false},
+		{name: "empty", data: "", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := hasArmorHeader([]byte(tt.data)); got != tt.want {
+				t.Errorf("expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestIsArmoredDoesNotConsume(t *testing.T) {
+	data := "\n" + armor.Header + "\n"
+	r := bufio.NewReader(strings.NewReader(data))
+
+	if !isArmored(r) {
+		t.Fatal("expected armor to be detected")
+	}
+	rest := new(bytes.Buffer)
+	rest.ReadFrom(r)
+	if rest.String() != data {
+		t.Errorf("expected the input to be left unread, got %q", rest)
+	}
+}
+
+func TestArmoredRoundTrip(t *testing.T) {
+	km, _, _ := newSignedTeam(t)
+	km.SetArmor(true)
+	km.SetEnvelope(true)
+	path := encryptTestFile(t, km, "prod.env", "API_KEY=abc\n")
+
+	encrypted, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, payload, _ := bytes.Cut(bytes.TrimPrefix(encrypted, envelopeMagic), []byte("\n"))
+	if !bytes.HasPrefix(payload, []byte(armor.Header)) || !bytes.HasSuffix(bytes.TrimSpace(payload), []byte(armor.Footer)) {
+		t.Fatalf("expected an armored payload after the envelope, got\n%s", payload)
+	}
+
+	if ok, err := IsEncrypted(path); err != nil || !ok {
+		t.Errorf("expected the armored file to be recognised, got %v (%v)", ok, err)
+	}
+
+	// Pasting adds blank lines around the armor
+	pasted := filepath.Join(t.TempDir(), "pasted.encrypted")
+	if err := os.WriteFile(pasted, append([]byte("\n\n"), payload...), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	d, err := km.NewDecryptor()
+	if err != nil {
+		t.Fatal(err)
+	}
+	plaintext, err := d.ReadFile(pasted)
+	if err != nil || string(plaintext) != "API_KEY=abc\n" {
+		t.Errorf("expected the pasted armor to decrypt, got %q (%v)", plaintext, err)
+	}
+}
@@ -0,0 +1,57 @@
+package crypto
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// Config holds repository defaults, stored in .lockbox/config and committed
+// with the repository so the whole team shares them
+type Config struct {
+	// Armor makes 'secret encrypt' write ASCII-armored ciphertext unless
+	// --armor=false is passed
+	Armor bool `json:"armor,omitempty"`
+}
+
+// LoadConfig reads .lockbox/config. A missing file is the default config.
+func (km *KeyManager) LoadConfig() (*Config, error) {
+	if km.localDir == "" {
+		return nil, fmt.Errorf("no local directory set")
+	}
+
+	data, err := os.ReadFile(filepath.Join(km.localDir, "config"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return &Config{}, nil
+		}
+		return nil, fmt.Errorf("failed to read config: %w", err)
+	}
+
+	var config Config
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("failed to parse config: %w", err)
+	}
+
+	return &config, nil
+}
+
+// SaveConfig writes .lockbox/config
+func (km *KeyManager) SaveConfig(config *Config) error {
+	if km.localDir == "" {
+		return fmt.Errorf("no local directory set")
+	}
+
+	data, err := json.MarshalIndent(config, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal config: %w", err)
+	}
+	data = append(data, '\n')
+
+	return writeFileAtomic(filepath.Join(km.localDir, "config"), func(w io.Writer) error {
+		_, err := w.Write(data)
+		return err
+	})
+}
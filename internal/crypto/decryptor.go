@@ -0,0 +1,259 @@
+package crypto
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+
+	"filippo.io/age"
+)
+
+// Decryptor tries every identity available to the user in a single age.Decrypt
+// call and remembers which one opened the file. Files can be decrypted from
+// several goroutines at once, and keys are unwrapped one at a time so a
+// passphrase is only asked for once, but Matched is then only meaningful
+// after decrypting a single file.
+type Decryptor struct {
+	km         *KeyManager
+	identities []age.Identity
+
+	mu      sync.Mutex
+	matched string
+	// locked names the protected keys that were skipped because they can't be
+	// unlocked without a prompt
+	locked []string
+}
+
+// NewDecryptor builds a Decryptor from identities supplied through the
+// environment, all personal keys, the repository private.key saved by 'team
+// init' when a local directory is set, and the user's SSH keys.
+// Passphrase-protected keys are tried last and only unlocked when reached.
+func (km *KeyManager) NewDecryptor() (*Decryptor, error) {
+	env, err := km.EnvironmentIdentities()
+	if err != nil {
+		return nil, err
+	}
+
+	personal, err := km.ListPersonalKeys()
+	if err != nil {
+		return nil, err
+	}
+
+	d := &Decryptor{km: km}
+	for i := range env {
+		d.identities = append(d.identities, &lazyIdentity{km: km, identity: &env[i], d: d})
+	}
+
+	var protected []age.Identity
+	for i := range personal {
+		id := &lazyIdentity{km: km, identity: &personal[i], d: d}
+		if personal[i].Protected() {
+			protected = append(protected, id)
+		} else {
+			d.identities = append(d.identities, id)
+		}
+	}
+
+	if km.localDir != "" {
+		repoKey, err := km.LoadPrivateKey()
+		if err != nil {
+			return nil, err
+		}
+		if repoKey != nil {
+			repoKey.Name = fmt.Sprintf("%s (repository key)", repoKey.Name)
+			d.identities = append(d.identities, &lazyIdentity{km: km, identity: repoKey, d: d})
+		}
+	}
+
+	d.identities = append(d.identities, protected...)
+	d.identities = append(d.identities, km.sshIdentities(d)...)
+	if len(d.identities) == 0 {
+		return nil, fmt.Errorf("no personal or SSH keys found. Create one with 'lockbox key add', or set %s", EnvIdentity)
+	}
+
+	return d, nil
+}
+
+// NewKeyDecryptor builds a Decryptor that only tries the named personal key
+func (km *KeyManager) NewKeyDecryptor(keyName string) (*Decryptor, error) {
+	identity, err := km.readPersonalKey(keyName)
+	if err != nil {
+		return nil, err
+	}
+
+	d := &Decryptor{km: km}
+	d.identities = []age.Identity{&lazyIdentity{km: km, identity: identity, d: d}}
+	return d, nil
+}
+
+// Matched returns the name of the identity that decrypted the last input
+func (d *Decryptor) Matched() string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.matched
+}
+
+// Decrypt decrypts data with whichever identity matches
+func (d *Decryptor) Decrypt(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := d.DecryptStream(&buf, bytes.NewReader(data)); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// DecryptStream decrypts src with whichever identity matches and writes the plaintext to dst
+func (d *Decryptor) DecryptStream(dst io.Writer, src io.Reader) error {
+	d.mu.Lock()
+	d.matched = ""
+	d.mu.Unlock()
+
+	src, _, err := stripEnvelope(src)
+	if err != nil {
+		return err
+	}
+
+	r, err := age.Decrypt(src, d.identities...)
+	if err != nil {
+		var noMatch *age.NoIdentityMatchError
+		if errors.As(err, &noMatch) {
+			d.mu.Lock()
+			defer d.mu.Unlock()
+			if len(d.locked) > 0 {
+				return fmt.Errorf("none of your keys can decrypt this file. Passphrase-protected keys were skipped: %s", strings.Join(d.locked, ", "))
+			}
+			return fmt.Errorf("none of your keys can decrypt this file")
+		}
+		return fmt.Errorf("failed to decrypt: %w", err)
+	}
+
+	if _, err := io.Copy(dst, r); err != nil {
+		return fmt.Errorf("failed to read decrypted data: %w", err)
+	}
+
+	return nil
+}
+
+// ReadFile decrypts the age or structured file at path in memory
+func (d *Decryptor) ReadFile(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read encrypted file: %w", err)
+	}
+
+	if IsStructured(path) {
+		format, err := DetectFormat(path)
+		if err != nil {
+			return nil, err
+		}
+		return d.DecryptStructured(data, format)
+	}
+
+	return d.Decrypt(data)
+}
+
+// DecryptFile decrypts the age or structured file at inputPath to outputPath.
+// Either may be StdioPath; stdin is always read as age.
+func (d *Decryptor) DecryptFile(inputPath string, outputPath string) error {
+	if inputPath != StdioPath && IsStructured(inputPath) {
+		return d.km.DecryptStructuredFile(inputPath, outputPath, d)
+	}
+
+	in, err := openInput(inputPath)
+	if err != nil {
+		return fmt.Errorf("failed to read encrypted file: %w", err)
+	}
+	defer in.Close()
+
+	hash := sha256.New()
+	err = writeFile(outputPath, func(out io.Writer) error {
+		src, done := withProgress(in, "Decrypting")
+		defer done()
+		return d.DecryptStream(io.MultiWriter(out, hash), src)
+	})
+	if err != nil {
+		return err
+	}
+
+	return d.km.recordPlaintextHash(outputPath, hash.Sum(nil))
+}
+
+// lazyIdentity defers unlocking and parsing a stored key until age asks it to
+// unwrap a file key, so protected keys only prompt when they are needed
+type lazyIdentity struct {
+	km       *KeyManager
+	identity *Identity
+	d        *Decryptor
+}
+
+func (l *lazyIdentity) Unwrap(stanzas []*age.Stanza) ([]byte, error) {
+	if !hasStanzaType(stanzas, "X25519") {
+		return nil, age.ErrIncorrectIdentity
+	}
+
+	l.d.mu.Lock()
+	defer l.d.mu.Unlock()
+
+	if err := l.km.unlock(l.identity); err != nil {
+		// Without a way to ask for the passphrase, let age try the other
+		// identities, such as SSH keys, instead of giving up
+		if errors.Is(err, ErrKeyLocked) {
+			l.d.locked = appendUnique(l.d.locked, l.identity.Name)
+			return nil, age.ErrIncorrectIdentity
+		}
+		return nil, err
+	}
+
+	identity, err := age.ParseX25519Identity(l.identity.PrivateKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid private key for %s: %w", l.identity.Name, err)
+	}
+
+	fileKey, err := identity.Unwrap(stanzas)
+	if err == nil {
+		l.d.matched = l.identity.Name
+	}
+	return fileKey, err
+}
+
+// namedIdentity records its name on the Decryptor when it unwraps a file key
+type namedIdentity struct {
+	name     string
+	identity age.Identity
+	d        *Decryptor
+}
+
+func (n *namedIdentity) Unwrap(stanzas []*age.Stanza) ([]byte, error) {
+	n.d.mu.Lock()
+	defer n.d.mu.Unlock()
+
+	fileKey, err := n.identity.Unwrap(stanzas)
+	if err == nil {
+		n.d.matched = n.name
+	}
+	return fileKey, err
+}
+
+func appendUnique(names []string, name string) []string {
+	for _, existing := range names {
+		if existing == name {
+			return names
+		}
+	}
+	return append(names, name)
+}
+
+func hasStanzaType(stanzas []*age.Stanza, stanzaType string) bool {
+	for _, s := range stanzas {
+		if s.Type == stanzaType {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,149 @@
+package crypto
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+
+	"filippo.io/age"
+)
+
+func TestDecryptorSkipsLockedKeys(t *testing.T) {
+	km := newTestKeyManager(t)
+
+	if _, err := km.GenerateProtectedKeyPair("locked", "passphrase"); err != nil {
+		t.Fatal(err)
+	}
+	plain, err := km.GenerateKeyPair("plain")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keys, err := km.ListPersonalKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Try the locked key first, as happens with SSH keys, which come after it
+	d := &Decryptor{km: km}
+	for i := range keys {
+		id := &lazyIdentity{km: km, identity: &keys[i], d: d}
+		if keys[i].Protected() {
+			d.identities = append([]age.Identity{id}, d.identities...)
+		} else {
+			d.identities = append(d.identities, id)
+		}
+	}
+
+	recipient, err := age.ParseX25519Recipient(plain.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var encrypted bytes.Buffer
+	w, err := age.Encrypt(&encrypted, recipient)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write([]byte("secret"))
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	plaintext, err := d.Decrypt(encrypted.Bytes())
+	if err != nil {
+		t.Fatalf("expected the unprotected key to decrypt, got %v", err)
+	}
+	if string(plaintext) != "secret" || d.Matched() != "plain" {
+		t.Errorf("expected plain to decrypt \"secret\", got %q with %s", plaintext, d.Matched())
+	}
+
+	// When only the locked key could open the file, the error says so
+	d.identities = d.identities[:1]
+	_, err = d.Decrypt(encrypted.Bytes())
+	if err == nil || !strings.Contains(err.Error(), "locked") {
+		t.Errorf("expected an error naming the skipped key, got %v", err)
+	}
+}
+
+func TestDecryptorSkipsKeysThePromptCantUnlock(t *testing.T) {
+	km := newTestKeyManager(t)
+
+	if _, err := km.GenerateProtectedKeyPair("locked", "passphrase"); err != nil {
+		t.Fatal(err)
+	}
+	plain, err := km.GenerateKeyPair("plain")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Fails the way prompt.KeyPassphrase does without a terminal
+	km.SetPassphraseFunc(func(name string) (string, error) {
+		return "", fmt.Errorf("key '%s' is %w and stdin is not a terminal", name, ErrKeyLocked)
+	})
+
+	keys, err := km.ListPersonalKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := &Decryptor{km: km}
+	for i := range keys {
+		id := &lazyIdentity{km: km, identity: &keys[i], d: d}
+		if keys[i].Protected() {
+			d.identities = append([]age.Identity{id}, d.identities...)
+		} else {
+			d.identities = append(d.identities, id)
+		}
+	}
+
+	recipient, err := age.ParseX25519Recipient(plain.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var encrypted bytes.Buffer
+	w, err := age.Encrypt(&encrypted, recipient)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write([]byte("secret"))
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := d.Decrypt(encrypted.Bytes()); err != nil {
+		t.Fatalf("expected the locked key to be skipped, got %v", err)
+	}
+
+	// A wrong passphrase is still an error
+	km.SetPassphraseFunc(func(string) (string, error) { return "wrong", nil })
+	if _, err := d.Decrypt(encrypted.Bytes()); err == nil {
+		t.Error("expected a wrong passphrase to fail")
+	}
+}
+
+func TestKeyManagerDecryptWithPrivateKey(t *testing.T) {
+	km := newTestKeyManager(t)
+
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var encrypted bytes.Buffer
+	w, err := age.Encrypt(&encrypted, identity.Recipient())
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write([]byte("secret"))
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	plaintext, err := km.Decrypt(encrypted.Bytes(), identity.String())
+	if err != nil || string(plaintext) != "secret" {
+		t.Errorf("expected \"secret\", got %q (%v)", plaintext, err)
+	}
+
+	if _, err := km.Decrypt(encrypted.Bytes(), "not a key"); err == nil || !strings.Contains(err.Error(), "invalid private key") {
+		t.Errorf("expected an invalid private key error, got %v", err)
+	}
+}
@@ -0,0 +1,183 @@
+package crypto
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"sync"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+)
+
+// Encryptor encrypts any number of files for the team. The team file is
+// loaded and checked, the policy read and every member's public key parsed
+// once when it is created, instead of for each file. It is safe for
+// concurrent use.
+type Encryptor struct {
+	km     *KeyManager
+	team   *TeamFile
+	policy *Policy
+
+	// recipients and invalid hold the parsed public key, or the parse error,
+	// of every member by member ID
+	recipients map[string]age.Recipient
+	invalid    map[string]error
+
+	// d opens earlier versions of structured files, see decryptor
+	d     *Decryptor
+	dErr  error
+	dOnce sync.Once
+}
+
+// NewEncryptor loads the team and policy and checks that the team can be trusted
+func (km *KeyManager) NewEncryptor() (*Encryptor, error) {
+	team, err := km.LoadTeam()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := km.checkTrust(team); err != nil {
+		return nil, err
+	}
+
+	policy, err := km.LoadPolicy()
+	if err != nil {
+		return nil, err
+	}
+
+	e := &Encryptor{
+		km:         km,
+		team:       team,
+		policy:     policy,
+		recipients: make(map[string]age.Recipient),
+		invalid:    make(map[string]error),
+	}
+	for _, member := range team.Members {
+		recipient, err := parseRecipient(member.PublicKey)
+		if err != nil {
+			e.invalid[member.ID] = fmt.Errorf("invalid public key for %s: %w", member.Name, err)
+			continue
+		}
+		e.recipients[member.ID] = recipient
+	}
+
+	return e, nil
+}
+
+// decryptor returns a Decryptor for the user's keys, created the first time
+// it is needed
+func (e *Encryptor) decryptor() (*Decryptor, error) {
+	e.dOnce.Do(func() {
+		e.d, e.dErr = e.km.NewDecryptor()
+	})
+	return e.d, e.dErr
+}
+
+// Recipients returns the team members a file at path is encrypted for, and
+// the policy rule that selected them (nil when no rule matched)
+func (e *Encryptor) Recipients(path string) ([]Member, *PolicyRule, error) {
+	return e.km.policyRecipients(e.team, e.policy, path)
+}
+
+// EncryptFile encrypts inputPath to outputPath and records it in the
+// manifest. Either may be StdioPath; recipients for stdin are chosen by the
+// output path.
+func (e *Encryptor) EncryptFile(inputPath string, outputPath string) error {
+	in, err := openInput(inputPath)
+	if err != nil {
+		return fmt.Errorf("failed to read input file: %w", err)
+	}
+	defer in.Close()
+
+	policyPath := inputPath
+	if inputPath == StdioPath {
+		policyPath = outputPath
+		if outputPath == StdioPath {
+			policyPath = ""
+		}
+	}
+
+	hash := sha256.New()
+	var members []Member
+	err = writeFile(outputPath, func(out io.Writer) error {
+		src, done := withProgress(in, "Encrypting")
+		defer done()
+		members, err = e.encryptStream(out, io.TeeReader(src, hash), policyPath)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := e.km.recordPlaintextHash(inputPath, hash.Sum(nil)); err != nil {
+		return err
+	}
+
+	return e.km.recordSecret(inputPath, outputPath, members)
+}
+
+// encryptStream encrypts src for the recipients of path, returning the
+// members it encrypted for
+func (e *Encryptor) encryptStream(dst io.Writer, src io.Reader, path string) ([]Member, error) {
+	w, members, err := e.writer(dst, path, e.km.envelope, e.km.armor)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := io.Copy(w, src); err != nil {
+		return nil, fmt.Errorf("failed to encrypt data: %w", err)
+	}
+
+	if err := w.Close(); err != nil {
+		return nil, fmt.Errorf("failed to finalize encryption: %w", err)
+	}
+
+	return members, nil
+}
+
+// writer returns a writer that encrypts everything written to it for the
+// recipients of path, along with the members those recipients belong to.
+// With envelope set, a lockbox envelope is written first, and with armored
+// set the age payload is written as ASCII armor. The caller must Close the
+// writer to finalize the ciphertext.
+func (e *Encryptor) writer(dst io.Writer, path string, envelope bool, armored bool) (io.WriteCloser, []Member, error) {
+	members, _, err := e.Recipients(path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if len(members) == 0 {
+		return nil, nil, fmt.Errorf("no team members found")
+	}
+
+	var recipients []age.Recipient
+	for _, member := range members {
+		if err := e.invalid[member.ID]; err != nil {
+			return nil, nil, err
+		}
+		recipients = append(recipients, e.recipients[member.ID])
+	}
+
+	if envelope {
+		if err := writeEnvelope(dst, newEnvelope(members, e.team)); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if !armored {
+		w, err := age.Encrypt(dst, recipients...)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to create encryption writer: %w", err)
+		}
+		return w, members, nil
+	}
+
+	a := armor.NewWriter(dst)
+	w, err := age.Encrypt(a, recipients...)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create encryption writer: %w", err)
+	}
+
+	return &armoredWriter{WriteCloser: w, armor: a}, members, nil
+}
@@ -0,0 +1,131 @@
+package crypto
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"filippo.io/age/armor"
+	"github.com/yourusername/lockbox/internal/version"
+)
+
+// envelopeMagic starts the optional lockbox envelope. The envelope is the
+// magic line followed by one line of JSON; everything after it is a standard
+// age file, so 'tail -n +3 file | age -d' works without lockbox.
+var envelopeMagic = []byte("lockbox-envelope/v1\n")
+
+// Envelope is metadata stored in front of the age payload. It is not
+// authenticated and only describes who the file was encrypted for.
+type Envelope struct {
+	Recipients     []EnvelopeRecipient `json:"recipients"`
+	TeamRevision   int                 `json:"team_revision"`
+	CreatedAt      time.Time           `json:"created_at"`
+	LockboxVersion string              `json:"lockbox_version"`
+}
+
+// EnvelopeRecipient identifies one recipient of an enveloped file
+type EnvelopeRecipient struct {
+	Name        string `json:"name"`
+	Fingerprint string `json:"fingerprint"`
+}
+
+// SetEnvelope makes Encrypt write a lockbox envelope in front of the age payload
+func (km *KeyManager) SetEnvelope(envelope bool) {
+	km.envelope = envelope
+}
+
+func newEnvelope(members []Member, team *TeamFile) *Envelope {
+	env := &Envelope{
+		TeamRevision:   team.Revision,
+		CreatedAt:      time.Now().UTC().Truncate(time.Second),
+		LockboxVersion: version.Version,
+	}
+	for _, member := range members {
+		env.Recipients = append(env.Recipients, EnvelopeRecipient{
+			Name:        member.Name,
+			Fingerprint: member.Fingerprint(),
+		})
+	}
+	return env
+}
+
+func writeEnvelope(w io.Writer, env *Envelope) error {
+	data, err := json.Marshal(env)
+	if err != nil {
+		return fmt.Errorf("failed to marshal envelope: %w", err)
+	}
+
+	if _, err := w.Write(envelopeMagic); err != nil {
+		return fmt.Errorf("failed to write envelope: %w", err)
+	}
+	if _, err := w.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to write envelope: %w", err)
+	}
+	return nil
+}
+
+// readEnvelope consumes the envelope from r if there is one. It returns nil
+// for plain age input, leaving r positioned at the payload either way.
+func readEnvelope(r *bufio.Reader) (*Envelope, error) {
+	magic, err := r.Peek(len(envelopeMagic))
+	if err != nil || !bytes.Equal(magic, envelopeMagic) {
+		return nil, nil
+	}
+
+	if _, err := r.Discard(len(envelopeMagic)); err != nil {
+		return nil, err
+	}
+
+	line, err := r.ReadBytes('\n')
+	if err != nil {
+		return nil, fmt.Errorf("failed to read envelope: %w", err)
+	}
+
+	var env Envelope
+	if err := json.Unmarshal(line, &env); err != nil {
+		return nil, fmt.Errorf("failed to parse envelope: %w", err)
+	}
+
+	return &env, nil
+}
+
+// stripEnvelope returns a reader over the binary age payload of src,
+// removing the envelope and ASCII armor if there are any
+func stripEnvelope(src io.Reader) (io.Reader, *Envelope, error) {
+	br := bufio.NewReader(src)
+	env, err := readEnvelope(br)
+	if err != nil {
+		return nil, nil, err
+	}
+	if isArmored(br) {
+		return armor.NewReader(br), env, nil
+	}
+	return br, env, nil
+}
+
+// ReadEnvelope returns the envelope of the encrypted file at path, or nil if
+// the file is a plain age file
+func ReadEnvelope(path string) (*Envelope, error) {
+	f, err := openInput(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read encrypted file: %w", err)
+	}
+	defer f.Close()
+
+	br := bufio.NewReader(f)
+	env, err := readEnvelope(br)
+	if err != nil {
+		return nil, err
+	}
+
+	if env == nil && !isArmored(br) {
+		if magic, _ := br.Peek(len(ageMagic)); !bytes.Equal(magic, ageMagic) {
+			return nil, fmt.Errorf("%s is not an encrypted file", path)
+		}
+	}
+
+	return env, nil
+}
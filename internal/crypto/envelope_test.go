@@ -0,0 +1,96 @@
+package crypto
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// encryptTestFile encrypts data into root/name.encrypted for the team
+func encryptTestFile(t *testing.T, km *KeyManager, name string, data string) string {
+	t.Helper()
+	root := filepath.Dir(km.localDir)
+
+	plaintextPath := filepath.Join(root, name)
+	if err := os.WriteFile(plaintextPath, []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := km.EncryptFile(plaintextPath, plaintextPath+".encrypted"); err != nil {
+		t.Fatal(err)
+	}
+	return plaintextPath + ".encrypted"
+}
+
+func TestEnvelope(t *testing.T) {
+	km, me, bob := newSignedTeam(t)
+	km.SetEnvelope(true)
+	path := encryptTestFile(t, km, "prod.env", "API_KEY=abc\n")
+
+	env, err := ReadEnvelope(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if env == nil || len(env.Recipients) != 2 {
+		t.Fatalf("expected an envelope naming two recipients, got %+v", env)
+	}
+	want := map[string]string{me.Name: me.Fingerprint(), bob.Name: bob.Fingerprint()}
+	for _, r := range env.Recipients {
+		if want[r.Name] != r.Fingerprint {
+			t.Errorf("expected %s to have fingerprint %s, got %s", r.Name, want[r.Name], r.Fingerprint)
+		}
+	}
+
+	encrypted, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !HasEncryptedHeader(encrypted) {
+		t.Error("expected the envelope to be recognised as encrypted")
+	}
+
+	// Everything after the envelope's two lines is a standard age file
+	_, payload, _ := bytes.Cut(bytes.TrimPrefix(encrypted, envelopeMagic), []byte("\n"))
+	if !bytes.HasPrefix(payload, ageMagic) {
+		t.Errorf("expected the age payload after the envelope, got %q", payload[:min(len(payload), 40)])
+	}
+
+	d, err := km.NewDecryptor()
+	if err != nil {
+		t.Fatal(err)
+	}
+	plaintext, err := d.Decrypt(encrypted)
+	if err != nil || string(plaintext) != "API_KEY=abc\n" {
+		t.Errorf("expected the enveloped file to decrypt, got %q (%v)", plaintext, err)
+	}
+}
+
+func TestReadEnvelopeWithoutEnvelope(t *testing.T) {
+	km, _, _ := newSignedTeam(t)
+	path := encryptTestFile(t, km, "prod.env", "API_KEY=abc\n")
+
+	env, err := ReadEnvelope(path)
+	if err != nil || env != nil {
+		t.Errorf("expected a plain age file to have no envelope, got %+v (%v)", env, err)
+	}
+
+	plain := filepath.Join(filepath.Dir(km.localDir), "notes.txt")
+	if err := os.WriteFile(plain, []byte("hello\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadEnvelope(plain); err == nil {
+		t.Error("expected a plaintext file to be refused")
+	}
+}
+
+func TestReadEnvelopeInvalid(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "broken.encrypted")
+	data := append(append([]byte(nil), envelopeMagic...), "{not json\n"...)
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := ReadEnvelope(path); err == nil {
+		t.Error("expected an invalid envelope to be refused")
+	}
+}
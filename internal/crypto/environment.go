@@ -0,0 +1,125 @@
+package crypto
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+
+	"filippo.io/age"
+)
+
+// Environment variables that supply an identity without a personal key
+// store, for CI jobs and other machines
+const (
+	// EnvIdentity holds one or more AGE-SECRET-KEY lines
+	EnvIdentity = "LOCKBOX_IDENTITY"
+	// EnvIdentityFile names a file holding the identity
+	EnvIdentityFile = "LOCKBOX_IDENTITY_FILE"
+	// EnvIdentityFD is the number of an open file descriptor to read the identity from
+	EnvIdentityFD = "LOCKBOX_IDENTITY_FD"
+)
+
+// MachineTag marks team members whose key belongs to a machine rather than a person
+const MachineTag = "machine"
+
+// EnvironmentIdentities returns the identities supplied through
+// LOCKBOX_IDENTITY, LOCKBOX_IDENTITY_FILE or LOCKBOX_IDENTITY_FD. They are
+// read once and cached, since a file descriptor can only be read once.
+func (km *KeyManager) EnvironmentIdentities() ([]Identity, error) {
+	if km.envIdentitiesLoaded {
+		return km.envIdentities, km.envIdentitiesErr
+	}
+	km.envIdentitiesLoaded = true
+	km.envIdentities, km.envIdentitiesErr = readEnvironmentIdentities()
+	return km.envIdentities, km.envIdentitiesErr
+}
+
+func readEnvironmentIdentities() ([]Identity, error) {
+	var sources []string
+	var data []byte
+
+	if value := os.Getenv(EnvIdentity); value != "" {
+		sources = append(sources, EnvIdentity)
+		data = append(data, value...)
+		data = append(data, '\n')
+	}
+
+	if path := os.Getenv(EnvIdentityFile); path != "" {
+		sources = append(sources, EnvIdentityFile)
+		fileData, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", EnvIdentityFile, err)
+		}
+		data = append(data, fileData...)
+		data = append(data, '\n')
+	}
+
+	if value := os.Getenv(EnvIdentityFD); value != "" {
+		sources = append(sources, EnvIdentityFD)
+		fd, err := strconv.Atoi(value)
+		if err != nil || fd < 0 {
+			return nil, fmt.Errorf("%s must be a file descriptor number, got %q", EnvIdentityFD, value)
+		}
+		f := os.NewFile(uintptr(fd), EnvIdentityFD)
+		if f == nil {
+			return nil, fmt.Errorf("%s: invalid file descriptor %d", EnvIdentityFD, fd)
+		}
+		fdData, err := io.ReadAll(f)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", EnvIdentityFD, err)
+		}
+		data = append(data, fdData...)
+	}
+
+	if len(sources) == 0 {
+		return nil, nil
+	}
+
+	parsed, err := age.ParseIdentities(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("invalid identity in %s: %w", sources[0], err)
+	}
+
+	var identities []Identity
+	for _, id := range parsed {
+		x25519, ok := id.(*age.X25519Identity)
+		if !ok {
+			continue
+		}
+		identities = append(identities, Identity{
+			Name:       fmt.Sprintf("%s (environment)", sources[0]),
+			PublicKey:  x25519.Recipient().String(),
+			PrivateKey: x25519.String(),
+		})
+	}
+
+	return identities, nil
+}
+
+// GenerateMachineKey creates an identity for a machine, such as a CI job, and
+// adds its public key to the team with the machine tag. The private key is not
+// stored anywhere, so the caller must hand it over right away.
+func (km *KeyManager) GenerateMachineKey(name string) (*Identity, *Member, error) {
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to generate key pair: %w", err)
+	}
+
+	member, err := km.AddTeamMember(&Member{
+		Name:      name,
+		PublicKey: identity.Recipient().String(),
+		Tags:      []string{MachineTag},
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return &Identity{
+		Name:       name,
+		PublicKey:  member.PublicKey,
+		PrivateKey: identity.String(),
+	}, member, nil
+}
@@ -0,0 +1,148 @@
+package crypto
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// verification records that the user compared a key's fingerprint out of band
+type verification struct {
+	Name       string
+	PublicKey  string
+	VerifiedAt time.Time
+}
+
+// fingerprintBytes is how much of the key hash a fingerprint shows
+const fingerprintBytes = 10
+
+// Fingerprint returns a short, hash-based fingerprint of the public key as
+// groups of hex digits, e.g. "3F2A 91BC 0D7E 55A1 C403"
+func (id *Identity) Fingerprint() string {
+	sum := fingerprintHash(id.PublicKey)
+	encoded := strings.ToUpper(hex.EncodeToString(sum[:fingerprintBytes]))
+
+	var groups []string
+	for i := 0; i < len(encoded); i += 4 {
+		groups = append(groups, encoded[i:i+4])
+	}
+	return strings.Join(groups, " ")
+}
+
+// FingerprintWords returns the first bytes of the fingerprint as words, which
+// are easier to read out loud than hex
+func (id *Identity) FingerprintWords() string {
+	sum := fingerprintHash(id.PublicKey)
+
+	words := make([]string, 6)
+	for i := range words {
+		words[i] = fingerprintWordList[sum[i]]
+	}
+	return strings.Join(words, "-")
+}
+
+// fingerprintHash hashes the key material only, so an SSH key's comment
+// doesn't change its fingerprint
+func fingerprintHash(publicKey string) [32]byte {
+	fields := strings.Fields(publicKey)
+	if len(fields) > 2 && strings.HasPrefix(fields[0], "ssh-") {
+		fields = fields[:2]
+	}
+	return sha256.Sum256([]byte(strings.Join(fields, " ")))
+}
+
+// MarkVerified records that the user has compared the fingerprint of identity
+// with its owner
+func (km *KeyManager) MarkVerified(identity *Identity) error {
+	verified, err := km.loadVerified()
+	if err != nil {
+		return err
+	}
+
+	verified[identity.Fingerprint()] = verification{
+		Name:       identity.Name,
+		PublicKey:  identity.PublicKey,
+		VerifiedAt: time.Now().UTC().Truncate(time.Second),
+	}
+
+	data, err := json.MarshalIndent(verified, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal verified keys: %w", err)
+	}
+
+	return os.WriteFile(filepath.Join(km.globalDir, "verified.json"), data, 0600)
+}
+
+// IsVerified reports whether the user has verified the identity's fingerprint.
+// The user's own keys always count as verified.
+func (km *KeyManager) IsVerified(identity *Identity) bool {
+	if km.localPublicKeys()[identity.PublicKey] {
+		return true
+	}
+
+	verified, err := km.loadVerified()
+	if err != nil {
+		return false
+	}
+
+	_, ok := verified[identity.Fingerprint()]
+	return ok
+}
+
+func (km *KeyManager) loadVerified() (map[string]verification, error) {
+	verified := make(map[string]verification)
+	data, err := os.ReadFile(filepath.Join(km.globalDir, "verified.json"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return verified, nil
+		}
+		return nil, fmt.Errorf("failed to read verified keys: %w", err)
+	}
+
+	if err := json.Unmarshal(data, &verified); err != nil {
+		return nil, fmt.Errorf("failed to parse verified keys: %w", err)
+	}
+
+	return verified, nil
+}
+
+// fingerprintWordList maps each byte value to a short, distinct word
+var fingerprintWordList = [256]string{
+	"acid", "acorn", "actor", "adobe", "agent", "alarm", "album", "alert",
+	"alley", "amber", "anchor", "angel", "ankle", "apple", "arena", "armor",
+	"arrow", "atlas", "attic", "audio", "autumn", "bacon", "badge", "bagel",
+	"baker", "bamboo", "banana", "banjo", "barrel", "basil", "basket", "beacon",
+	"beaver", "bench", "berry", "bison", "blanket", "bonfire", "breeze", "brick",
+	"bridge", "bronze", "bubble", "bucket", "butter", "cabin", "cactus", "camel",
+	"canal", "candle", "canoe", "canyon", "captain", "carbon", "carpet", "castle",
+	"cedar", "cello", "chalk", "cherry", "chess", "cider", "circus", "clover",
+	"cobalt", "cocoa", "comet", "copper", "coral", "cotton", "coyote", "cradle",
+	"crater", "crayon", "cricket", "crystal", "dahlia", "daisy", "dancer", "delta",
+	"denim", "desert", "diamond", "dinner", "dolphin", "donkey", "dragon", "drum",
+	"dune", "eagle", "easel", "echo", "elbow", "ember", "engine", "falcon",
+	"feather", "fiddle", "fig", "finch", "flame", "flannel", "flute", "forest",
+	"fossil", "fox", "frost", "galaxy", "garden", "garlic", "gecko", "geyser",
+	"ginger", "glacier", "globe", "goose", "granite", "grape", "gravel", "guitar",
+	"hammer", "harbor", "harvest", "hazel", "helmet", "heron", "honey", "hornet",
+	"husky", "igloo", "indigo", "iris", "island", "ivory", "jacket", "jaguar",
+	"jelly", "jigsaw", "jungle", "kayak", "kernel", "kettle", "kiwi", "koala",
+	"ladder", "lagoon", "lantern", "laser", "lemon", "lentil", "lilac", "lily",
+	"lizard", "locket", "lotus", "magnet", "mango", "maple", "marble", "meadow",
+	"melon", "meteor", "mint", "mirror", "mitten", "monkey", "muffin", "mustard",
+	"napkin", "nectar", "needle", "nickel", "noodle", "nutmeg", "oasis", "oboe",
+	"ocean", "olive", "onion", "orbit", "orchid", "otter", "owl", "paddle",
+	"panda", "papaya", "parrot", "peach", "pebble", "pepper", "piano", "pickle",
+	"pigeon", "pillow", "pine", "pirate", "planet", "plum", "pocket", "pony",
+	"poppy", "potato", "puffin", "pumpkin", "quartz", "quill", "rabbit", "radar",
+	"radish", "raven", "ribbon", "river", "robin", "rocket", "rose", "ruby",
+	"saddle", "salmon", "sandal", "satin", "scarf", "shadow", "sierra", "silver",
+	"sketch", "sled", "spruce", "squid", "summit", "sunset", "tango", "teapot",
+	"thunder", "tiger", "timber", "tomato", "topaz", "torch", "tulip", "tundra",
+	"turtle", "valley", "velvet", "violet", "violin", "walnut", "walrus", "wave",
+	"willow", "window", "wizard", "yacht", "yarn", "yogurt", "zebra", "zigzag",
+}
@@ -0,0 +1,72 @@
+package crypto
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestFingerprint(t *testing.T) {
+	id := Identity{PublicKey: newPublicKey(t)}
+
+	if !regexp.MustCompile(`^[0-9A-F]{4}( [0-9A-F]{4}){4}$`).MatchString(id.Fingerprint()) {
+		t.Errorf("expected five groups of four hex digits, got %q", id.Fingerprint())
+	}
+	if words := strings.Split(id.FingerprintWords(), "-"); len(words) != 6 {
+		t.Errorf("expected six words, got %q", id.FingerprintWords())
+	}
+
+	other := Identity{PublicKey: newPublicKey(t)}
+	if other.Fingerprint() == id.Fingerprint() {
+		t.Error("expected different keys to have different fingerprints")
+	}
+}
+
+func TestFingerprintIgnoresSSHComment(t *testing.T) {
+	key := "ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIGb0Aw8uxqYMzR0vRQWHnUfM8fW1ShL1zJx8j5J1Wvv6"
+	a := Identity{PublicKey: key + " alice@laptop"}
+	b := Identity{PublicKey: key}
+
+	if a.Fingerprint() != b.Fingerprint() || a.FingerprintWords() != b.FingerprintWords() {
+		t.Errorf("expected the comment not to change the fingerprint, got %q and %q", a.Fingerprint(), b.Fingerprint())
+	}
+}
+
+func TestFingerprintWordListIsDistinct(t *testing.T) {
+	seen := make(map[string]bool)
+	for _, word := range fingerprintWordList {
+		if word == "" || seen[word] {
+			t.Errorf("expected 256 distinct words, %q is empty or repeated", word)
+		}
+		seen[word] = true
+	}
+}
+
+func TestMarkVerified(t *testing.T) {
+	km := newTestKeyManager(t)
+
+	own, err := km.GenerateKeyPair("me")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !km.IsVerified(own) {
+		t.Error("expected the user's own key to count as verified")
+	}
+
+	bob := &Identity{Name: "bob", PublicKey: newPublicKey(t)}
+	if km.IsVerified(bob) {
+		t.Fatal("expected bob not to be verified yet")
+	}
+	if err := km.MarkVerified(bob); err != nil {
+		t.Fatal(err)
+	}
+	if !km.IsVerified(bob) {
+		t.Error("expected bob to be verified")
+	}
+
+	// Verification follows the key, not the name
+	bob.PublicKey = newPublicKey(t)
+	if km.IsVerified(bob) {
+		t.Error("expected a changed key to need verifying again")
+	}
+}
@@ -3,23 +3,53 @@ package crypto
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"filippo.io/age"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
+
+	"github.com/yourusername/lockbox/internal/output"
 )
 
 type Identity struct {
 	Name       string
 	PublicKey  string
 	PrivateKey string // Only set for personal keys
+
+	// EncryptedPrivateKey holds the passphrase-wrapped private key when the
+	// personal key is protected. PrivateKey is left empty on disk in that case.
+	EncryptedPrivateKey string `json:",omitempty"`
 }
 
+// Protected reports whether the identity's private key is wrapped with a passphrase
+func (id *Identity) Protected() bool {
+	return id.EncryptedPrivateKey != ""
+}
+
+// PassphraseFunc is called to obtain the passphrase for a protected personal key
+type PassphraseFunc func(keyName string) (string, error)
+
 type KeyManager struct {
-	globalDir string // ~/.lockbox
-	localDir  string // ./.lockbox
+	globalDir  string // ~/.lockbox
+	localDir   string // ./.lockbox
+	passphrase PassphraseFunc
+
+	allowUntrusted bool
+	trustWarned    bool
+	envelope       bool
+	armor          bool
+
+	envIdentities       []Identity
+	envIdentitiesErr    error
+	envIdentitiesLoaded bool
+
+	// mu serialises updates to the manifest and plaintext hashes, which
+	// concurrent Encryptor and Decryptor workers share
+	mu sync.Mutex
 }
 
 func NewKeyManager() (*KeyManager, error) {
@@ -42,8 +72,25 @@ func (km *KeyManager) SetLocalDir(dir string) {
 	km.localDir = dir
 }
 
+// SetPassphraseFunc sets the callback used to unlock passphrase-protected personal keys
+func (km *KeyManager) SetPassphraseFunc(fn PassphraseFunc) {
+	km.passphrase = fn
+}
+
+// SetAllowUntrusted lets Encrypt proceed, with a warning, when the signed team
+// file contains members or changes the user can't trust
+func (km *KeyManager) SetAllowUntrusted(allow bool) {
+	km.allowUntrusted = allow
+}
+
 // Personal key management
 func (km *KeyManager) GenerateKeyPair(name string) (*Identity, error) {
+	return km.GenerateProtectedKeyPair(name, "")
+}
+
+// GenerateProtectedKeyPair creates a personal key whose private half is
+// wrapped with the given passphrase. An empty passphrase stores it unprotected.
+func (km *KeyManager) GenerateProtectedKeyPair(name string, passphrase string) (*Identity, error) {
 	identity, err := age.GenerateX25519Identity()
 	if err != nil {
 		return nil, fmt.Errorf("failed to generate key pair: %w", err)
@@ -55,20 +102,31 @@ func (km *KeyManager) GenerateKeyPair(name string) (*Identity, error) {
 		PrivateKey: identity.String(),
 	}
 
-	if err := km.savePersonalKey(id); err != nil {
+	if err := km.savePersonalKey(id, passphrase); err != nil {
 		return nil, err
 	}
 
 	return id, nil
 }
 
-func (km *KeyManager) savePersonalKey(identity *Identity) error {
+func (km *KeyManager) savePersonalKey(identity *Identity, passphrase string) error {
 	keysDir := filepath.Join(km.globalDir, "keys")
 	if err := os.MkdirAll(keysDir, 0700); err != nil {
 		return fmt.Errorf("failed to create keys directory: %w", err)
 	}
 
-	data, err := json.Marshal(identity)
+	stored := *identity
+	stored.EncryptedPrivateKey = ""
+	if passphrase != "" {
+		wrapped, err := wrapPrivateKey(identity.PrivateKey, passphrase)
+		if err != nil {
+			return err
+		}
+		stored.PrivateKey = ""
+		stored.EncryptedPrivateKey = wrapped
+	}
+
+	data, err := json.Marshal(&stored)
 	if err != nil {
 		return fmt.Errorf("failed to marshal identity: %w", err)
 	}
@@ -77,7 +135,21 @@ func (km *KeyManager) savePersonalKey(identity *Identity) error {
 	return os.WriteFile(keyPath, data, 0600)
 }
 
+// getPersonalKey loads a personal key, prompting for its passphrase if it is protected
 func (km *KeyManager) getPersonalKey(name string) (*Identity, error) {
+	identity, err := km.readPersonalKey(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := km.unlock(identity); err != nil {
+		return nil, err
+	}
+
+	return identity, nil
+}
+
+func (km *KeyManager) readPersonalKey(name string) (*Identity, error) {
 	keyPath := filepath.Join(km.globalDir, "keys", fmt.Sprintf("%s.json", name))
 	data, err := os.ReadFile(keyPath)
 	if err != nil {
@@ -92,6 +164,52 @@ func (km *KeyManager) getPersonalKey(name string) (*Identity, error) {
 	return &identity, nil
 }
 
+// ErrKeyLocked is returned by unlock for a protected key when there is no
+// passphrase callback to ask with. Passphrase callbacks wrap it when they
+// can't ask either, so decryption moves on to the other identities.
+var ErrKeyLocked = errors.New("passphrase-protected")
+
+// unlock fills in PrivateKey for a protected identity using the passphrase callback
+func (km *KeyManager) unlock(identity *Identity) error {
+	if !identity.Protected() || identity.PrivateKey != "" {
+		return nil
+	}
+
+	if km.passphrase == nil {
+		return fmt.Errorf("key %s is %w", identity.Name, ErrKeyLocked)
+	}
+
+	passphrase, err := km.passphrase(identity.Name)
+	if err != nil {
+		return err
+	}
+
+	privateKey, err := unwrapPrivateKey(identity.EncryptedPrivateKey, passphrase)
+	if err != nil {
+		return fmt.Errorf("failed to unlock key %s: %w", identity.Name, err)
+	}
+
+	identity.PrivateKey = privateKey
+	return nil
+}
+
+// ChangePassphrase adds, changes or removes the passphrase on a personal key.
+// The key is unlocked through the passphrase callback first, then newPassphrase
+// is asked for the replacement. An empty replacement stores the key unprotected.
+func (km *KeyManager) ChangePassphrase(name string, newPassphrase func() (string, error)) error {
+	identity, err := km.getPersonalKey(name)
+	if err != nil {
+		return err
+	}
+
+	passphrase, err := newPassphrase()
+	if err != nil {
+		return err
+	}
+
+	return km.savePersonalKey(identity, passphrase)
+}
+
 func (km *KeyManager) ListPersonalKeys() ([]Identity, error) {
 	keysDir := filepath.Join(km.globalDir, "keys")
 	entries, err := os.ReadDir(keysDir)
@@ -125,148 +243,147 @@ func (km *KeyManager) RemovePersonalKey(name string) error {
 	return os.Remove(keyPath)
 }
 
-// Team key management
-func (km *KeyManager) SaveTeamKey(identity *Identity) error {
-	if km.localDir == "" {
-		return fmt.Errorf("no local directory set")
-	}
+// StdioPath stands for stdin as an input path and stdout as an output path
+const StdioPath = "-"
 
-	keysFile := filepath.Join(km.localDir, "team-keys.txt")
-	f, err := os.OpenFile(keysFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
-	if err != nil {
-		return fmt.Errorf("failed to open team keys file: %w", err)
+// openInput opens path for reading, or returns stdin for StdioPath
+func openInput(path string) (*os.File, error) {
+	if path == StdioPath {
+		return os.Stdin, nil
 	}
-	defer f.Close()
-
-	_, err = fmt.Fprintf(f, "# %s\n%s\n", identity.Name, identity.PublicKey)
-	return err
+	return os.Open(path)
 }
 
-func (km *KeyManager) ListTeamKeys() ([]Identity, error) {
-	if km.localDir == "" {
-		return nil, fmt.Errorf("no local directory set")
-	}
+// progressThreshold is the input size above which file helpers show progress
+const progressThreshold = 64 << 20
 
-	keysFile := filepath.Join(km.localDir, "team-keys.txt")
-	data, err := os.ReadFile(keysFile)
+// File encryption/decryption
+func (km *KeyManager) EncryptFile(inputPath string, outputPath string) error {
+	e, err := km.NewEncryptor()
 	if err != nil {
-		if os.IsNotExist(err) {
-			return nil, nil
-		}
-		return nil, fmt.Errorf("failed to read team keys file: %w", err)
+		return err
 	}
 
-	var identities []Identity
-	var currentName string
+	return e.EncryptFile(inputPath, outputPath)
+}
 
-	lines := strings.Split(string(data), "\n")
-	for _, line := range lines {
-		line = strings.TrimSpace(line)
-		if line == "" {
-			continue
-		}
-		if strings.HasPrefix(line, "#") {
-			currentName = strings.TrimSpace(strings.TrimPrefix(line, "#"))
-		} else {
-			identities = append(identities, Identity{
-				Name:      currentName,
-				PublicKey: line,
-			})
-		}
+// DecryptFile decrypts inputPath to outputPath with the named personal key,
+// see NewKeyDecryptor
+func (km *KeyManager) DecryptFile(inputPath string, outputPath string, keyName string) error {
+	d, err := km.NewKeyDecryptor(keyName)
+	if err != nil {
+		return err
 	}
 
-	return identities, nil
+	return d.DecryptFile(inputPath, outputPath)
 }
 
-// File encryption/decryption
-func (km *KeyManager) EncryptFile(inputPath string, outputPath string) error {
-	data, err := os.ReadFile(inputPath)
-	if err != nil {
-		return fmt.Errorf("failed to read input file: %w", err)
+// writeFile creates outputPath, fills it using write and removes it again if
+// write fails. StdioPath writes to stdout.
+func writeFile(outputPath string, write func(io.Writer) error) error {
+	if outputPath == StdioPath {
+		return write(os.Stdout)
 	}
 
-	encrypted, err := km.Encrypt(data)
+	out, err := os.OpenFile(outputPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
 	if err != nil {
+		return fmt.Errorf("failed to create output file: %w", err)
+	}
+
+	if err := write(out); err != nil {
+		out.Close()
+		os.Remove(outputPath)
 		return err
 	}
 
-	return os.WriteFile(outputPath, encrypted, 0644)
+	if err := out.Close(); err != nil {
+		os.Remove(outputPath)
+		return fmt.Errorf("failed to write output file: %w", err)
+	}
+
+	return nil
 }
 
-func (km *KeyManager) DecryptFile(inputPath string, outputPath string, keyName string) error {
-	data, err := os.ReadFile(inputPath)
-	if err != nil {
-		return fmt.Errorf("failed to read encrypted file: %w", err)
+// withProgress wraps f in a progress indicator when it is larger than progressThreshold
+func withProgress(f *os.File, label string) (io.Reader, func()) {
+	info, err := f.Stat()
+	if err != nil || info.Size() < progressThreshold {
+		return f, func() {}
 	}
 
-	identity, err := km.getPersonalKey(keyName)
-	if err != nil {
-		return err
-	}
+	progress := output.NewProgress(label, info.Size())
+	return progress.Reader(f), progress.Done
+}
 
-	decrypted, err := km.Decrypt(data, identity.PrivateKey)
-	if err != nil {
-		return err
+// Encrypt encrypts data for the team members the policy selects for path.
+// An empty path encrypts for the whole team.
+func (km *KeyManager) Encrypt(data []byte, path string) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := km.EncryptStream(&buf, bytes.NewReader(data), path); err != nil {
+		return nil, err
 	}
 
-	return os.WriteFile(outputPath, decrypted, 0644)
+	return buf.Bytes(), nil
 }
 
-// Encrypt encrypts data for all team members
-func (km *KeyManager) Encrypt(data []byte) ([]byte, error) {
-	identities, err := km.ListTeamKeys()
+// Decrypt decrypts data using the given private key
+func (km *KeyManager) Decrypt(data []byte, privateKey string) ([]byte, error) {
+	d, err := km.privateKeyDecryptor(privateKey)
 	if err != nil {
 		return nil, err
 	}
 
-	if len(identities) == 0 {
-		return nil, fmt.Errorf("no team members found")
-	}
+	return d.Decrypt(data)
+}
 
-	var recipients []age.Recipient
-	for _, identity := range identities {
-		recipient, err := age.ParseX25519Recipient(identity.PublicKey)
-		if err != nil {
-			return nil, fmt.Errorf("invalid public key for %s: %w", identity.Name, err)
-		}
-		recipients = append(recipients, recipient)
-	}
+// EncryptStream encrypts src for the team members the policy selects for path
+// and writes the ciphertext to dst. An empty path encrypts for the whole team.
+func (km *KeyManager) EncryptStream(dst io.Writer, src io.Reader, path string) error {
+	_, err := km.encryptStream(dst, src, path)
+	return err
+}
 
-	var buf bytes.Buffer
-	w, err := age.Encrypt(&buf, recipients...)
+// encryptStream is EncryptStream, also returning the members it encrypted for
+func (km *KeyManager) encryptStream(dst io.Writer, src io.Reader, path string) ([]Member, error) {
+	e, err := km.NewEncryptor()
 	if err != nil {
-		return nil, fmt.Errorf("failed to create encryption writer: %w", err)
+		return nil, err
 	}
 
-	if _, err := io.Copy(w, bytes.NewReader(data)); err != nil {
-		return nil, fmt.Errorf("failed to encrypt data: %w", err)
-	}
+	return e.encryptStream(dst, src, path)
+}
 
-	if err := w.Close(); err != nil {
-		return nil, fmt.Errorf("failed to finalize encryption: %w", err)
+// DecryptStream decrypts src using the given private key and writes the plaintext to dst
+func (km *KeyManager) DecryptStream(dst io.Writer, src io.Reader, privateKey string) error {
+	d, err := km.privateKeyDecryptor(privateKey)
+	if err != nil {
+		return err
 	}
 
-	return buf.Bytes(), nil
+	return d.DecryptStream(dst, src)
 }
 
-// Decrypt decrypts data using the user's private key
-func (km *KeyManager) Decrypt(data []byte, privateKey string) ([]byte, error) {
-	identity, err := age.ParseX25519Identity(privateKey)
-	if err != nil {
+// privateKeyDecryptor builds a Decryptor that only tries privateKey
+func (km *KeyManager) privateKeyDecryptor(privateKey string) (*Decryptor, error) {
+	if _, err := age.ParseX25519Identity(privateKey); err != nil {
 		return nil, fmt.Errorf("invalid private key: %w", err)
 	}
 
-	r, err := age.Decrypt(bytes.NewReader(data), identity)
-	if err != nil {
-		return nil, fmt.Errorf("failed to decrypt: %w", err)
-	}
+	d := &Decryptor{km: km}
+	identity := &Identity{Name: "private key", PrivateKey: privateKey}
+	d.identities = []age.Identity{&lazyIdentity{km: km, identity: identity, d: d}}
+	return d, nil
+}
 
-	var buf bytes.Buffer
-	if _, err := io.Copy(&buf, r); err != nil {
-		return nil, fmt.Errorf("failed to read decrypted data: %w", err)
+// encryptWriter returns a writer that encrypts everything written to it for
+// the recipients of path, see Encryptor.writer
+func (km *KeyManager) encryptWriter(dst io.Writer, path string, envelope bool, armored bool) (io.WriteCloser, []Member, error) {
+	e, err := km.NewEncryptor()
+	if err != nil {
+		return nil, nil, err
 	}
 
-	return buf.Bytes(), nil
+	return e.writer(dst, path, envelope, armored)
 }
 
 // SavePrivateKey saves the user's private key
@@ -297,54 +414,3 @@ func (km *KeyManager) LoadPrivateKey() (*Identity, error) {
 
 	return &identity, nil
 }
-
-func (km *KeyManager) RemoveTeamKey(publicKey string) error {
-	if km.localDir == "" {
-		return fmt.Errorf("no local directory set")
-	}
-
-	keysFile := filepath.Join(km.localDir, "team-keys.txt")
-	data, err := os.ReadFile(keysFile)
-	if err != nil {
-		if os.IsNotExist(err) {
-			return nil
-		}
-		return fmt.Errorf("failed to read team keys file: %w", err)
-	}
-
-	var lines []string
-	var skipNext bool
-
-	for _, line := range strings.Split(string(data), "\n") {
-		line = strings.TrimSpace(line)
-		if line == "" {
-			continue
-		}
-		if strings.HasPrefix(line, "#") {
-			if !skipNext {
-				lines = append(lines, line)
-			}
-			skipNext = false
-		} else {
-			if line == publicKey {
-				skipNext = true
-				continue
-			}
-			if !skipNext {
-				lines = append(lines, line)
-			}
-		}
-	}
-
-	if len(lines) == 0 {
-		return os.Remove(keysFile)
-	}
-
-	var buf bytes.Buffer
-	for _, line := range lines {
-		buf.WriteString(line)
-		buf.WriteString("\n")
-	}
-
-	return os.WriteFile(keysFile, buf.Bytes(), 0644)
-} 
\ No newline at end of file
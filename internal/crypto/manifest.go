@@ -0,0 +1,254 @@
+package crypto
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ManifestVersion is the current version of .lockbox/manifest
+const ManifestVersion = 1
+
+// Manifest is the index of secrets managed by lockbox, stored in .lockbox/manifest
+type Manifest struct {
+	Version int             `json:"version"`
+	Secrets []ManifestEntry `json:"secrets"`
+}
+
+// ManifestEntry records one encrypted secret. Paths are slash-separated and
+// relative to the repository root.
+type ManifestEntry struct {
+	Plaintext      string    `json:"plaintext"`
+	Ciphertext     string    `json:"ciphertext"`
+	RecipientsHash string    `json:"recipients_hash"`
+	Recipients     []string  `json:"recipients"` // member IDs
+	EncryptedAt    time.Time `json:"encrypted_at"`
+	EncryptedBy    string    `json:"encrypted_by,omitempty"`
+
+	// RecipientNames maps member IDs to their names at encryption time, so
+	// members who have since left the team can still be named
+	RecipientNames map[string]string `json:"recipient_names,omitempty"`
+}
+
+// RecipientName returns the name a recipient had when the secret was
+// encrypted, or the member ID for entries recorded before names were
+func (e *ManifestEntry) RecipientName(id string) string {
+	if name := e.RecipientNames[id]; name != "" {
+		return name
+	}
+	return id
+}
+
+// RecipientSetHash hashes a set of public keys independent of their order, so
+// a secret's recorded recipients can be compared with the current team
+func RecipientSetHash(publicKeys []string) string {
+	sorted := append([]string(nil), publicKeys...)
+	sort.Strings(sorted)
+
+	sum := sha256.Sum256([]byte(strings.Join(sorted, "\n")))
+	return hex.EncodeToString(sum[:])
+}
+
+// MembersHash returns the RecipientSetHash of the members' public keys
+func MembersHash(members []Member) string {
+	var publicKeys []string
+	for _, member := range members {
+		publicKeys = append(publicKeys, member.PublicKey)
+	}
+	return RecipientSetHash(publicKeys)
+}
+
+// LoadManifest reads .lockbox/manifest. A missing file is an empty manifest.
+func (km *KeyManager) LoadManifest() (*Manifest, error) {
+	if km.localDir == "" {
+		return nil, fmt.Errorf("no local directory set")
+	}
+
+	data, err := os.ReadFile(filepath.Join(km.localDir, "manifest"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return &Manifest{Version: ManifestVersion}, nil
+		}
+		return nil, fmt.Errorf("failed to read manifest: %w", err)
+	}
+
+	var manifest Manifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("failed to parse manifest: %w", err)
+	}
+
+	if manifest.Version > ManifestVersion {
+		return nil, fmt.Errorf("manifest version %d is newer than this lockbox supports", manifest.Version)
+	}
+
+	return &manifest, nil
+}
+
+// ListSecrets returns every secret recorded in the manifest
+func (km *KeyManager) ListSecrets() ([]ManifestEntry, error) {
+	manifest, err := km.LoadManifest()
+	if err != nil {
+		return nil, err
+	}
+
+	return manifest.Secrets, nil
+}
+
+// FindSecret returns the manifest entry for a ciphertext path, or nil
+func (km *KeyManager) FindSecret(ciphertextPath string) (*ManifestEntry, error) {
+	manifest, err := km.LoadManifest()
+	if err != nil {
+		return nil, err
+	}
+
+	relPath, ok := km.repoPath(ciphertextPath)
+	if !ok {
+		return nil, nil
+	}
+
+	for i := range manifest.Secrets {
+		if manifest.Secrets[i].Ciphertext == relPath {
+			return &manifest.Secrets[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// ForgetSecret removes the manifest entry for a ciphertext path
+func (km *KeyManager) ForgetSecret(ciphertextPath string) error {
+	km.mu.Lock()
+	defer km.mu.Unlock()
+
+	manifest, err := km.LoadManifest()
+	if err != nil {
+		return err
+	}
+
+	relPath, ok := km.repoPath(ciphertextPath)
+	if !ok {
+		return fmt.Errorf("%s is outside the repository", ciphertextPath)
+	}
+
+	var secrets []ManifestEntry
+	for _, entry := range manifest.Secrets {
+		if entry.Ciphertext != relPath {
+			secrets = append(secrets, entry)
+		}
+	}
+
+	if len(secrets) == len(manifest.Secrets) {
+		return fmt.Errorf("%s is not in the manifest", relPath)
+	}
+
+	manifest.Secrets = secrets
+	return km.saveManifest(manifest)
+}
+
+// AbsPath turns a repository-relative manifest path into an absolute path
+func (km *KeyManager) AbsPath(relPath string) string {
+	return filepath.Join(filepath.Dir(km.localDir), filepath.FromSlash(relPath))
+}
+
+// recordSecret adds or updates the manifest entry for ciphertextPath. An empty
+// plaintextPath keeps the recorded one, or derives it by dropping ".encrypted".
+// Ciphertext written to stdout or outside the repository isn't recorded.
+func (km *KeyManager) recordSecret(plaintextPath string, ciphertextPath string, members []Member) error {
+	if ciphertextPath == StdioPath {
+		return nil
+	}
+	if plaintextPath == StdioPath {
+		plaintextPath = ""
+	}
+
+	ciphertext, ok := km.repoPath(ciphertextPath)
+	if !ok {
+		return nil
+	}
+
+	km.mu.Lock()
+	defer km.mu.Unlock()
+
+	manifest, err := km.LoadManifest()
+	if err != nil {
+		return err
+	}
+
+	var entry *ManifestEntry
+	for i := range manifest.Secrets {
+		if manifest.Secrets[i].Ciphertext == ciphertext {
+			entry = &manifest.Secrets[i]
+			break
+		}
+	}
+	if entry == nil {
+		manifest.Secrets = append(manifest.Secrets, ManifestEntry{Ciphertext: ciphertext})
+		entry = &manifest.Secrets[len(manifest.Secrets)-1]
+	}
+
+	if plaintextPath != "" {
+		if plaintext, ok := km.repoPath(plaintextPath); ok {
+			entry.Plaintext = plaintext
+		}
+	}
+	if entry.Plaintext == "" {
+		entry.Plaintext = strings.TrimSuffix(ciphertext, ".encrypted")
+	}
+
+	entry.Recipients = nil
+	entry.RecipientNames = make(map[string]string)
+	for _, member := range members {
+		entry.Recipients = append(entry.Recipients, member.ID)
+		entry.RecipientNames[member.ID] = member.Name
+	}
+	entry.RecipientsHash = MembersHash(members)
+	entry.EncryptedAt = time.Now().UTC().Truncate(time.Second)
+	entry.EncryptedBy = km.currentUser()
+
+	sort.Slice(manifest.Secrets, func(i, j int) bool {
+		return manifest.Secrets[i].Ciphertext < manifest.Secrets[j].Ciphertext
+	})
+
+	return km.saveManifest(manifest)
+}
+
+func (km *KeyManager) saveManifest(manifest *Manifest) error {
+	manifest.Version = ManifestVersion
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal manifest: %w", err)
+	}
+	data = append(data, '\n')
+
+	return writeFileAtomic(filepath.Join(km.localDir, "manifest"), func(w io.Writer) error {
+		_, err := w.Write(data)
+		return err
+	})
+}
+
+// repoPath returns path relative to the repository root with forward
+// slashes, and false if it lies outside the repository
+func (km *KeyManager) repoPath(path string) (string, bool) {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return "", false
+	}
+
+	root, err := filepath.Abs(filepath.Dir(km.localDir))
+	if err != nil {
+		return "", false
+	}
+
+	relPath, err := filepath.Rel(root, absPath)
+	if err != nil || relPath == ".." || strings.HasPrefix(relPath, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+
+	return filepath.ToSlash(relPath), true
+}
@@ -0,0 +1,114 @@
+package crypto
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRecipientSetHash(t *testing.T) {
+	a, b := newPublicKey(t), newPublicKey(t)
+
+	if RecipientSetHash([]string{a, b}) != RecipientSetHash([]string{b, a}) {
+		t.Error("expected the hash not to depend on order")
+	}
+	if RecipientSetHash([]string{a, b}) == RecipientSetHash([]string{a}) {
+		t.Error("expected different sets to hash differently")
+	}
+}
+
+func TestRepoPath(t *testing.T) {
+	km := newTestKeyManager(t)
+	root := filepath.Dir(km.localDir)
+
+	tests := []struct {
+		path string
+		want string
+		ok   bool
+	}{
+		{path: filepath.Join(root, "config", "prod.env"), want: "config/prod.env", ok: true},
+		{path: filepath.Join(root, "..dotted"), want: "..dotted", ok: true},
+		{path: filepath.Join(root, "..", "outside.env"), ok: false},
+		{path: filepath.Dir(root), ok: false},
+	}
+	for _, tt := range tests {
+		got, ok := km.repoPath(tt.path)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("repoPath(%s): expected (%q, %v), got (%q, %v)", tt.path, tt.want, tt.ok, got, ok)
+		}
+	}
+}
+
+func TestRecordSecret(t *testing.T) {
+	km, me, bob := newSignedTeam(t)
+	root := filepath.Dir(km.localDir)
+	members := []Member{*me, *bob}
+
+	ciphertext := filepath.Join(root, "config", "prod.env.encrypted")
+	if err := km.recordSecret("", ciphertext, members); err != nil {
+		t.Fatal(err)
+	}
+	if err := km.recordSecret(filepath.Join(root, "b.txt"), filepath.Join(root, "a.age"), members[:1]); err != nil {
+		t.Fatal(err)
+	}
+
+	// Outside the repository and stdout aren't recorded
+	if err := km.recordSecret("", filepath.Join(t.TempDir(), "x.encrypted"), members); err != nil {
+		t.Fatal(err)
+	}
+	if err := km.recordSecret("", StdioPath, members); err != nil {
+		t.Fatal(err)
+	}
+
+	secrets, err := km.ListSecrets()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(secrets) != 2 || secrets[0].Ciphertext != "a.age" || secrets[1].Ciphertext != "config/prod.env.encrypted" {
+		t.Fatalf("expected two entries sorted by ciphertext, got %+v", secrets)
+	}
+	if secrets[0].Plaintext != "b.txt" || secrets[1].Plaintext != "config/prod.env" {
+		t.Errorf("expected plaintext b.txt and config/prod.env, got %q and %q", secrets[0].Plaintext, secrets[1].Plaintext)
+	}
+
+	entry, err := km.FindSecret(ciphertext)
+	if err != nil || entry == nil {
+		t.Fatalf("expected to find %s, got %v", ciphertext, err)
+	}
+	if entry.RecipientsHash != MembersHash(members) || len(entry.Recipients) != 2 || entry.RecipientName(bob.ID) != "bob" {
+		t.Errorf("expected me and bob as recipients, got %+v", entry)
+	}
+
+	// Re-recording keeps the plaintext path and updates the recipients
+	if err := km.recordSecret("", filepath.Join(root, "a.age"), members); err != nil {
+		t.Fatal(err)
+	}
+	entry, err = km.FindSecret(filepath.Join(root, "a.age"))
+	if err != nil || entry.Plaintext != "b.txt" || len(entry.Recipients) != 2 {
+		t.Errorf("expected b.txt with two recipients, got %+v (%v)", entry, err)
+	}
+
+	if err := km.ForgetSecret(ciphertext); err != nil {
+		t.Fatal(err)
+	}
+	if entry, _ := km.FindSecret(ciphertext); entry != nil {
+		t.Error("expected the forgotten secret to be gone")
+	}
+	if err := km.ForgetSecret(ciphertext); err == nil {
+		t.Error("expected forgetting an unknown secret to fail")
+	}
+}
+
+func TestLoadManifestRefusesNewerVersion(t *testing.T) {
+	km := newTestKeyManager(t)
+	if err := os.MkdirAll(km.localDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(km.localDir, "manifest"), []byte(`{"version": 99, "secrets": []}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := km.LoadManifest(); err == nil {
+		t.Error("expected a newer manifest version to be refused")
+	}
+}
@@ -0,0 +1,61 @@
+package crypto
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+)
+
+// wrapPrivateKey encrypts a private key with an scrypt passphrase recipient and
+// returns it armored, so it can be stored as a string in the key file.
+func wrapPrivateKey(privateKey string, passphrase string) (string, error) {
+	recipient, err := age.NewScryptRecipient(passphrase)
+	if err != nil {
+		return "", fmt.Errorf("failed to create passphrase recipient: %w", err)
+	}
+
+	var buf bytes.Buffer
+	aw := armor.NewWriter(&buf)
+	w, err := age.Encrypt(aw, recipient)
+	if err != nil {
+		return "", fmt.Errorf("failed to create encryption writer: %w", err)
+	}
+
+	if _, err := io.WriteString(w, privateKey); err != nil {
+		return "", fmt.Errorf("failed to encrypt private key: %w", err)
+	}
+
+	if err := w.Close(); err != nil {
+		return "", fmt.Errorf("failed to finalize encryption: %w", err)
+	}
+
+	if err := aw.Close(); err != nil {
+		return "", fmt.Errorf("failed to finalize armor: %w", err)
+	}
+
+	return buf.String(), nil
+}
+
+// unwrapPrivateKey reverses wrapPrivateKey
+func unwrapPrivateKey(wrapped string, passphrase string) (string, error) {
+	identity, err := age.NewScryptIdentity(passphrase)
+	if err != nil {
+		return "", fmt.Errorf("failed to create passphrase identity: %w", err)
+	}
+
+	r, err := age.Decrypt(armor.NewReader(strings.NewReader(wrapped)), identity)
+	if err != nil {
+		return "", err
+	}
+
+	var buf bytes.Buffer
+	if _, err := io.Copy(&buf, r); err != nil {
+		return "", fmt.Errorf("failed to read private key: %w", err)
+	}
+
+	return buf.String(), nil
+}
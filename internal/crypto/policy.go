@@ -0,0 +1,203 @@
+package crypto
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// AllGroup is the reserved group name that stands for every team member
+const AllGroup = "all"
+
+// Policy maps path globs to recipient groups. It is read from .lockbox/policy,
+// where each line holds a glob followed by one or more group names:
+//
+//	# path glob           groups
+//	config/prod/**        ops
+//	config/staging/**     ops dev
+//	*.env                 all
+//
+// The first matching rule wins. Paths that match no rule are encrypted for
+// the whole team.
+type Policy struct {
+	Rules []PolicyRule
+}
+
+// PolicyRule is a single line of the policy file
+type PolicyRule struct {
+	Pattern string
+	Groups  []string
+	Line    int
+}
+
+func (r *PolicyRule) String() string {
+	return fmt.Sprintf("%s -> %s (.lockbox/policy:%d)", r.Pattern, strings.Join(r.Groups, ", "), r.Line)
+}
+
+// LoadPolicy reads .lockbox/policy. A missing file is an empty policy.
+func (km *KeyManager) LoadPolicy() (*Policy, error) {
+	if km.localDir == "" {
+		return nil, fmt.Errorf("no local directory set")
+	}
+
+	data, err := os.ReadFile(filepath.Join(km.localDir, "policy"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return &Policy{}, nil
+		}
+		return nil, fmt.Errorf("failed to read policy file: %w", err)
+	}
+
+	return parsePolicy(data)
+}
+
+func parsePolicy(data []byte) (*Policy, error) {
+	policy := &Policy{}
+	for i, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			return nil, fmt.Errorf("policy line %d: expected a path glob followed by at least one group", i+1)
+		}
+
+		if _, err := path.Match(strings.ReplaceAll(fields[0], "**", "*"), ""); err != nil {
+			return nil, fmt.Errorf("policy line %d: invalid glob %q: %w", i+1, fields[0], err)
+		}
+
+		policy.Rules = append(policy.Rules, PolicyRule{
+			Pattern: fields[0],
+			Groups:  fields[1:],
+			Line:    i + 1,
+		})
+	}
+
+	return policy, nil
+}
+
+// Match returns the first rule matching the slash-separated, repository
+// relative path, or nil
+func (p *Policy) Match(relPath string) *PolicyRule {
+	if relPath == "" {
+		return nil
+	}
+
+	for i := range p.Rules {
+		if matchGlob(p.Rules[i].Pattern, relPath) {
+			return &p.Rules[i]
+		}
+	}
+	return nil
+}
+
+// matchGlob matches like path.Match, with "**" matching any number of path
+// segments. Patterns without a slash match the file name in any directory.
+func matchGlob(pattern string, name string) bool {
+	if !strings.Contains(pattern, "/") {
+		matched, _ := path.Match(pattern, path.Base(name))
+		return matched
+	}
+
+	return matchSegments(strings.Split(strings.TrimPrefix(pattern, "/"), "/"), strings.Split(name, "/"))
+}
+
+func matchSegments(pattern []string, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(name); i++ {
+				if matchSegments(pattern[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+
+		if len(name) == 0 {
+			return false
+		}
+		if matched, _ := path.Match(pattern[0], name[0]); !matched {
+			return false
+		}
+
+		pattern, name = pattern[1:], name[1:]
+	}
+
+	return len(name) == 0
+}
+
+// RecipientsFor returns the team members a file at path should be encrypted
+// for, and the policy rule that selected them (nil when no rule matched).
+// The path may be absolute or relative to the working directory; a trailing
+// ".encrypted" is ignored so ciphertext paths match the same rules.
+func (km *KeyManager) RecipientsFor(filePath string) ([]Member, *PolicyRule, error) {
+	team, err := km.LoadTeam()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return km.recipientsFor(team, filePath)
+}
+
+func (km *KeyManager) recipientsFor(team *TeamFile, filePath string) ([]Member, *PolicyRule, error) {
+	policy, err := km.LoadPolicy()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return km.policyRecipients(team, policy, filePath)
+}
+
+func (km *KeyManager) policyRecipients(team *TeamFile, policy *Policy, filePath string) ([]Member, *PolicyRule, error) {
+	rule := policy.Match(km.policyPath(filePath))
+	if rule == nil {
+		return team.Members, nil, nil
+	}
+
+	selected := make(map[string]bool)
+	for _, group := range rule.Groups {
+		if group == AllGroup {
+			return team.Members, rule, nil
+		}
+
+		ids, ok := team.Groups[group]
+		if !ok {
+			return nil, nil, fmt.Errorf("policy rule %s refers to unknown group %q", rule, group)
+		}
+		for _, id := range ids {
+			selected[id] = true
+		}
+	}
+
+	var members []Member
+	for _, member := range team.Members {
+		if selected[member.ID] {
+			members = append(members, member)
+		}
+	}
+
+	if len(members) == 0 {
+		return nil, nil, fmt.Errorf("policy rule %s matches no team members", rule)
+	}
+
+	return members, rule, nil
+}
+
+// policyPath turns a file path into the slash-separated path relative to the
+// repository root that policy rules are matched against
+func (km *KeyManager) policyPath(filePath string) string {
+	if filePath == "" {
+		return ""
+	}
+
+	relPath, ok := km.repoPath(filePath)
+	if !ok {
+		return ""
+	}
+
+	return strings.TrimSuffix(relPath, ".encrypted")
+}
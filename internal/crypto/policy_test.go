@@ -0,0 +1,108 @@
+package crypto
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMatchGlob(t *testing.T) {
+	tests := []struct {
+		pattern string
+		name    string
+		want    bool
+	}{
+		{pattern: "*.env", name: "prod.env", want: true},
+		{pattern: "*.env", name: "config/deep/prod.env", want: true},
+		{pattern: "*.env", name: "prod.env.bak", want: false},
+		{pattern: "config/*.yaml", name: "config/prod.yaml", want: true},
+		{pattern: "config/*.yaml", name: "config/prod/db.yaml", want: false},
+		{pattern: "/config/*.yaml", name: "config/prod.yaml", want: true},
+		{pattern: "config/**", name: "config/prod/db.yaml", want: true},
+		{pattern: "config/**", name: "config", want: true},
+		{pattern: "config/**", name: "configs/db.yaml", want: false},
+		{pattern: "**/secrets/*", name: "secrets/a", want: true},
+		{pattern: "**/secrets/*", name: "app/eu/secrets/a", want: true},
+		{pattern: "config/**/db.yaml", name: "config/db.yaml", want: true},
+		{pattern: "config/**/db.yaml", name: "config/prod/eu/db.yaml", want: true},
+		{pattern: "config/**/db.yaml", name: "config/prod/eu/api.yaml", want: false},
+	}
+	for _, tt := range tests {
+		if got := matchGlob(tt.pattern, tt.name); got != tt.want {
+			t.Errorf("matchGlob(%q, %q): expected %v, got %v", tt.pattern, tt.name, tt.want, got)
+		}
+	}
+}
+
+func TestParsePolicy(t *testing.T) {
+	data := "# path glob   groups\n\nconfig/prod/**  ops\n*.env  ops dev\n"
+	policy, err := parsePolicy([]byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rule := policy.Match("config/prod/db.env")
+	if rule == nil || rule.Line != 3 || strings.Join(rule.Groups, ",") != "ops" {
+		t.Errorf("expected the first matching rule, line 3, to win, got %v", rule)
+	}
+	if rule := policy.Match("app.env"); rule == nil || rule.Line != 4 {
+		t.Errorf("expected line 4 to match app.env, got %v", rule)
+	}
+	if rule := policy.Match("README.md"); rule != nil {
+		t.Errorf("expected no rule to match README.md, got %v", rule)
+	}
+
+	for _, bad := range []string{"config/**\n", "config/[ ops\n"} {
+		if _, err := parsePolicy([]byte(bad)); err == nil || !strings.Contains(err.Error(), "line 1") {
+			t.Errorf("expected %q to be refused naming line 1, got %v", bad, err)
+		}
+	}
+}
+
+func TestPolicyRecipients(t *testing.T) {
+	km, me, bob := newSignedTeam(t)
+	if err := km.AddToGroup("ops", bob.ID); err != nil {
+		t.Fatal(err)
+	}
+	team, err := km.LoadTeam()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	policy, err := parsePolicy([]byte("prod/** ops\nshared/** all\nbroken/** missing\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := filepath.Dir(km.localDir)
+
+	tests := []struct {
+		path string
+		want []string
+		err  string
+	}{
+		{path: filepath.Join(root, "prod", "db.env.encrypted"), want: []string{bob.ID}},
+		{path: filepath.Join(root, "shared", "a.env"), want: []string{me.ID, bob.ID}},
+		{path: filepath.Join(root, "other.env"), want: []string{me.ID, bob.ID}},
+		{path: filepath.Join(root, "broken", "a.env"), err: `unknown group "missing"`},
+	}
+	for _, tt := range tests {
+		members, _, err := km.policyRecipients(team, policy, tt.path)
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("%s: expected an error containing %q, got %v", tt.path, tt.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var ids []string
+		for _, member := range members {
+			ids = append(ids, member.ID)
+		}
+		if strings.Join(ids, ",") != strings.Join(tt.want, ",") {
+			t.Errorf("%s: expected %v, got %v", tt.path, tt.want, ids)
+		}
+	}
+}
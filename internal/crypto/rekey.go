@@ -0,0 +1,175 @@
+package crypto
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ageMagic is the first line of every binary age file
+var ageMagic = []byte("age-encryption.org/v1\n")
+
+// IsEncrypted reports whether the file at path is an age-encrypted file,
+// binary or armored, with or without a lockbox envelope
+func IsEncrypted(path string) (bool, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	header, err := bufio.NewReader(f).Peek(max(len(ageMagic), len(envelopeMagic), armorPeek))
+	if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+		return false, err
+	}
+
+	return HasEncryptedHeader(header), nil
+}
+
+// HasEncryptedHeader reports whether data starts like an age file, armored
+// or not, or a lockbox envelope
+func HasEncryptedHeader(data []byte) bool {
+	return bytes.HasPrefix(data, ageMagic) || bytes.HasPrefix(data, envelopeMagic) || hasArmorHeader(data)
+}
+
+// FindEncryptedFiles walks root and returns every age-encrypted regular file,
+// skipping the .git directory
+func FindEncryptedFiles(root string) ([]string, error) {
+	var files []string
+	err := filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if entry.IsDir() {
+			if entry.Name() == ".git" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if !entry.Type().IsRegular() {
+			return nil
+		}
+
+		encrypted, err := IsEncrypted(path)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", path, err)
+		}
+		if encrypted {
+			files = append(files, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return files, nil
+}
+
+// RekeyFile decrypts path with d and re-encrypts it in place for the current
+// team, following the policy for the plaintext it was encrypted from. Files that had an envelope get a fresh
+// one, and armored files stay armored. The file is replaced atomically, so a
+// failure leaves the original intact.
+func (km *KeyManager) RekeyFile(path string, d *Decryptor) error {
+	if IsStructured(path) {
+		return km.rekeyStructured(path, d)
+	}
+
+	plaintextPath, err := km.plaintextPath(path)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to read encrypted file: %w", err)
+	}
+	defer f.Close()
+
+	in := bufio.NewReader(f)
+	env, err := readEnvelope(in)
+	if err != nil {
+		return err
+	}
+	envelope := km.envelope || env != nil
+	armored := km.armor || isArmored(in)
+
+	var members []Member
+	err = writeFileAtomic(path, func(out io.Writer) error {
+		var w io.WriteCloser
+		w, members, err = km.encryptWriter(out, plaintextPath, envelope, armored)
+		if err != nil {
+			return err
+		}
+
+		if err := d.DecryptStream(w, in); err != nil {
+			return err
+		}
+
+		if err := w.Close(); err != nil {
+			return fmt.Errorf("failed to finalize encryption: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return km.recordSecret("", path, members)
+}
+
+// plaintextPath returns the plaintext path the policy is matched against when
+// re-encrypting ciphertextPath: the one recorded in the manifest, or the
+// ciphertext path without ".encrypted" for files the manifest doesn't know
+func (km *KeyManager) plaintextPath(ciphertextPath string) (string, error) {
+	entry, err := km.FindSecret(ciphertextPath)
+	if err != nil {
+		return "", err
+	}
+	if entry != nil && entry.Plaintext != "" {
+		return km.AbsPath(entry.Plaintext), nil
+	}
+	return strings.TrimSuffix(ciphertextPath, ".encrypted"), nil
+}
+
+// writeFileAtomic writes to a temporary file next to path and renames it over
+// path once write succeeds, keeping the original file mode
+func writeFileAtomic(path string, write func(io.Writer) error) error {
+	mode := os.FileMode(0644)
+	if info, err := os.Stat(path); err == nil {
+		mode = info.Mode().Perm()
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := write(tmp); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Chmod(mode); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to set file mode: %w", err)
+	}
+
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write temporary file: %w", err)
+	}
+
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to replace %s: %w", path, err)
+	}
+
+	return nil
+}
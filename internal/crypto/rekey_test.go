@@ -0,0 +1,108 @@
+package crypto
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"filippo.io/age"
+)
+
+func TestRekeyFile(t *testing.T) {
+	km, _, _ := newSignedTeam(t)
+	root := filepath.Dir(km.localDir)
+
+	plaintextPath := filepath.Join(root, "prod.env")
+	ciphertextPath := plaintextPath + ".encrypted"
+	if err := os.WriteFile(plaintextPath, []byte("API_KEY=abc\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	km.SetArmor(true)
+	if err := km.EncryptFile(plaintextPath, ciphertextPath); err != nil {
+		t.Fatal(err)
+	}
+	km.SetArmor(false)
+
+	carol, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := km.AddTeamMember(&Member{Name: "carol", PublicKey: carol.Recipient().String()}); err != nil {
+		t.Fatal(err)
+	}
+
+	d, err := km.NewDecryptor()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := km.RekeyFile(ciphertextPath, d); err != nil {
+		t.Fatal(err)
+	}
+
+	encrypted, err := os.ReadFile(ciphertextPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !hasArmorHeader(encrypted) {
+		t.Error("expected the armored file to stay armored")
+	}
+	plaintext, err := km.Decrypt(encrypted, carol.String())
+	if err != nil || string(plaintext) != "API_KEY=abc\n" {
+		t.Errorf("expected carol to decrypt the re-encrypted file, got %q (%v)", plaintext, err)
+	}
+
+	entry, err := km.FindSecret(ciphertextPath)
+	if err != nil || entry == nil || len(entry.Recipients) != 3 {
+		t.Errorf("expected the manifest to list 3 recipients, got %+v (%v)", entry, err)
+	}
+
+	files, err := FindEncryptedFiles(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 || files[0] != ciphertextPath {
+		t.Errorf("expected only %s to be found, got %v", ciphertextPath, files)
+	}
+}
+
+func TestRekeyFileKeepsOriginalOnFailure(t *testing.T) {
+	km, _, _ := newSignedTeam(t)
+	root := filepath.Dir(km.localDir)
+
+	// Encrypted for someone else, so it can't be decrypted
+	stranger, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var encrypted bytes.Buffer
+	w, err := age.Encrypt(&encrypted, stranger.Recipient())
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write([]byte("secret"))
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(root, "other.env.encrypted")
+	if err := os.WriteFile(path, encrypted.Bytes(), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	d, err := km.NewDecryptor()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := km.RekeyFile(path, d); err == nil {
+		t.Fatal("expected rekeying a file nobody here can decrypt to fail")
+	}
+
+	after, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(after, encrypted.Bytes()) {
+		t.Error("expected the original file to be left intact")
+	}
+}
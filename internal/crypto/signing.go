@@ -0,0 +1,482 @@
+package crypto
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/yourusername/lockbox/internal/output"
+)
+
+// Signature is a signature made by a team member over part of the team file
+type Signature struct {
+	Signer    string `json:"signer"` // member ID
+	Signature string `json:"signature"`
+}
+
+// TrustReport describes how much of the team file can be trusted from the
+// point of view of the current user
+type TrustReport struct {
+	// Signed is false for teams that have never been signed, including
+	// legacy team-keys.txt files
+	Signed bool
+	// Downgraded is set when the team file is unsigned but the team was signed
+	// before, because a root is pinned for the repository or entries still
+	// carry signatures. It is treated like a signed team with problems.
+	Downgraded bool
+	Threshold  int
+	Trusted    map[string]bool // member ID -> trusted
+	Untrusted  []Member
+	Problems   []string
+}
+
+// OK reports whether every member and the file itself are trusted
+func (r *TrustReport) OK() bool {
+	return r.Signed && len(r.Problems) == 0
+}
+
+// signingKeyFromPrivateKey derives a member's ed25519 signing key from their
+// age private key, so members don't have to manage a second secret
+func signingKeyFromPrivateKey(privateKey string) ed25519.PrivateKey {
+	seed := sha256.Sum256([]byte("lockbox-signing-v1\n" + privateKey))
+	return ed25519.NewKeyFromSeed(seed[:])
+}
+
+func encodeSigningKey(key ed25519.PrivateKey) string {
+	return base64.StdEncoding.EncodeToString(key.Public().(ed25519.PublicKey))
+}
+
+// memberPayload is the data a vouch for m covers. Tags are only included when
+// present, so entries signed before tags existed still verify.
+func memberPayload(m *Member) []byte {
+	parts := []string{
+		"lockbox-member-v1",
+		m.ID,
+		m.Name,
+		m.Email,
+		m.PublicKey,
+		m.SigningKey,
+	}
+	if len(m.Tags) > 0 {
+		parts = append(parts, "tags "+strings.Join(m.Tags, " "))
+	}
+	return []byte(strings.Join(parts, "\n"))
+}
+
+// teamPayload is the data the file signature covers: the revision, the
+// threshold, the root, every member entry in order and the groups
+func teamPayload(team *TeamFile) []byte {
+	parts := []string{
+		"lockbox-team-v1",
+		strconv.Itoa(team.Revision),
+		strconv.Itoa(team.Threshold),
+		team.Root,
+	}
+	for i := range team.Members {
+		parts = append(parts, string(memberPayload(&team.Members[i])))
+	}
+
+	var groups []string
+	for group := range team.Groups {
+		groups = append(groups, group)
+	}
+	sort.Strings(groups)
+	for _, group := range groups {
+		parts = append(parts, "group "+group+"\n"+strings.Join(team.Groups[group], "\n"))
+	}
+
+	return []byte(strings.Join(parts, "\n\n"))
+}
+
+func sign(key ed25519.PrivateKey, signerID string, payload []byte) Signature {
+	return Signature{
+		Signer:    signerID,
+		Signature: base64.StdEncoding.EncodeToString(ed25519.Sign(key, payload)),
+	}
+}
+
+func verify(signer *Member, sig Signature, payload []byte) bool {
+	if signer.SigningKey == "" {
+		return false
+	}
+	publicKey, err := base64.StdEncoding.DecodeString(signer.SigningKey)
+	if err != nil || len(publicKey) != ed25519.PublicKeySize {
+		return false
+	}
+	signature, err := base64.StdEncoding.DecodeString(sig.Signature)
+	if err != nil {
+		return false
+	}
+	return ed25519.Verify(publicKey, payload, signature)
+}
+
+// localPublicKeys returns the public keys of every identity the user holds.
+// Protected keys don't need unlocking since their public half is stored in the clear.
+func (km *KeyManager) localPublicKeys() map[string]bool {
+	keys := make(map[string]bool)
+	if personal, err := km.ListPersonalKeys(); err == nil {
+		for _, id := range personal {
+			keys[id.PublicKey] = true
+		}
+	}
+	if repoKey, err := km.LoadPrivateKey(); err == nil && repoKey != nil {
+		keys[repoKey.PublicKey] = true
+	}
+	if env, err := km.EnvironmentIdentities(); err == nil {
+		for _, id := range env {
+			keys[id.PublicKey] = true
+		}
+	}
+	return keys
+}
+
+// OwnMember returns the team member entry for one of the user's own keys, or
+// nil if the user isn't on the team
+func (km *KeyManager) OwnMember() (*Member, error) {
+	members, err := km.ListTeamMembers()
+	if err != nil {
+		return nil, err
+	}
+
+	local := km.localPublicKeys()
+	for i := range members {
+		if local[members[i].PublicKey] {
+			return &members[i], nil
+		}
+	}
+
+	return nil, nil
+}
+
+// signer finds an identity held by the user that is a member of team, unlocks
+// it and returns the member together with its signing key. The member's
+// signing key is recorded in the team if it was missing. It returns nil when
+// the user isn't a member.
+func (km *KeyManager) signer(team *TeamFile) (*Member, ed25519.PrivateKey, error) {
+	var candidates []*Identity
+	if repoKey, err := km.LoadPrivateKey(); err != nil {
+		return nil, nil, err
+	} else if repoKey != nil {
+		candidates = append(candidates, repoKey)
+	}
+
+	personal, err := km.ListPersonalKeys()
+	if err != nil {
+		return nil, nil, err
+	}
+	for i := range personal {
+		candidates = append(candidates, &personal[i])
+	}
+
+	for _, candidate := range candidates {
+		for i := range team.Members {
+			member := &team.Members[i]
+			if member.PublicKey != candidate.PublicKey {
+				continue
+			}
+
+			if err := km.unlock(candidate); err != nil {
+				return nil, nil, err
+			}
+
+			key := signingKeyFromPrivateKey(candidate.PrivateKey)
+			if encoded := encodeSigningKey(key); member.SigningKey != encoded {
+				// Recording the key changes the entry, so older vouches no longer apply
+				member.SigningKey = encoded
+				member.Signatures = nil
+			}
+			return member, key, nil
+		}
+	}
+
+	return nil, nil, nil
+}
+
+// vouch adds signer's signature to member, replacing an earlier one by the same signer
+func vouch(member *Member, signer *Member, key ed25519.PrivateKey) {
+	var signatures []Signature
+	for _, sig := range member.Signatures {
+		if sig.Signer != signer.ID {
+			signatures = append(signatures, sig)
+		}
+	}
+	member.Signatures = append(signatures, sign(key, signer.ID, memberPayload(member)))
+}
+
+// signTeam bumps the revision and signs the whole team file
+func signTeam(team *TeamFile, signer *Member, key ed25519.PrivateKey) {
+	team.Revision++
+	sig := sign(key, signer.ID, teamPayload(team))
+	team.Signature = &sig
+}
+
+// SignTeamMember vouches for the member with the given ID and re-signs the team file
+func (km *KeyManager) SignTeamMember(memberID string) error {
+	team, err := km.loadTeamForWrite()
+	if err != nil {
+		return err
+	}
+
+	signer, key, err := km.signer(team)
+	if err != nil {
+		return err
+	}
+	if signer == nil {
+		return fmt.Errorf("only team members can sign membership changes")
+	}
+
+	member := findMember(team, memberID)
+	if member == nil {
+		return fmt.Errorf("no team member with ID %s", memberID)
+	}
+
+	if member.ID != signer.ID {
+		vouch(member, signer, key)
+	}
+	if team.Root == "" {
+		// The first member to sign an unsigned team becomes its root
+		team.Root = signer.ID
+	}
+	signTeam(team, signer, key)
+	return km.saveTeam(team)
+}
+
+// SetThreshold sets how many trusted members must sign a new member before
+// they are trusted as a recipient
+func (km *KeyManager) SetThreshold(threshold int) error {
+	if threshold < 1 {
+		return fmt.Errorf("threshold must be at least 1")
+	}
+
+	team, err := km.loadTeamForWrite()
+	if err != nil {
+		return err
+	}
+
+	signer, key, err := km.signer(team)
+	if err != nil {
+		return err
+	}
+	if signer == nil {
+		return fmt.Errorf("only team members can sign membership changes")
+	}
+
+	team.Threshold = threshold
+	if team.Root == "" {
+		team.Root = signer.ID
+	}
+	signTeam(team, signer, key)
+	return km.saveTeam(team)
+}
+
+func findMember(team *TeamFile, memberID string) *Member {
+	for i := range team.Members {
+		if team.Members[i].ID == memberID {
+			return &team.Members[i]
+		}
+	}
+	return nil
+}
+
+// VerifyTeam works out which members the current user can trust. The user's
+// own keys and the pinned team root are trusted outright, and any other member
+// is trusted once enough trusted members have signed their entry.
+func (km *KeyManager) VerifyTeam() (*TrustReport, error) {
+	team, err := km.LoadTeam()
+	if err != nil {
+		return nil, err
+	}
+
+	return km.verifyTeam(team)
+}
+
+func (km *KeyManager) verifyTeam(team *TeamFile) (*TrustReport, error) {
+	report := &TrustReport{
+		Signed:    team.Root != "",
+		Threshold: team.threshold(),
+		Trusted:   make(map[string]bool),
+	}
+
+	if !report.Signed {
+		report.Untrusted = team.Members
+
+		pinned, err := km.pinnedRoot()
+		if err != nil {
+			return nil, err
+		}
+		if pinned != "" || team.everSigned() {
+			report.Downgraded = true
+			report.Problems = append(report.Problems, "the team file is not signed, but this team has been signed before")
+			return report, nil
+		}
+
+		report.Problems = append(report.Problems, "the team file is not signed, run 'lockbox team sign' to start signing membership changes")
+		return report, nil
+	}
+
+	local := km.localPublicKeys()
+	for _, member := range team.Members {
+		if local[member.PublicKey] {
+			report.Trusted[member.ID] = true
+		}
+	}
+
+	if root := findMember(team, team.Root); root == nil {
+		report.Problems = append(report.Problems, "the team root is not a member")
+	} else if err := km.checkPinnedRoot(root); err != nil {
+		report.Problems = append(report.Problems, err.Error())
+	} else {
+		report.Trusted[root.ID] = true
+	}
+
+	for changed := true; changed; {
+		changed = false
+		for i := range team.Members {
+			member := &team.Members[i]
+			if report.Trusted[member.ID] {
+				continue
+			}
+			if countTrustedSignatures(team, member, report.Trusted) >= report.Threshold {
+				report.Trusted[member.ID] = true
+				changed = true
+			}
+		}
+	}
+
+	for _, member := range team.Members {
+		if !report.Trusted[member.ID] {
+			report.Untrusted = append(report.Untrusted, member)
+			report.Problems = append(report.Problems, fmt.Sprintf("%s has not been signed by enough trusted members", member.Name))
+		}
+	}
+
+	if team.Signature == nil {
+		report.Problems = append(report.Problems, "the team file has unsigned changes")
+	} else if signer := findMember(team, team.Signature.Signer); signer == nil || !report.Trusted[signer.ID] {
+		report.Problems = append(report.Problems, "the team file was last signed by an untrusted member")
+	} else if !verify(signer, *team.Signature, teamPayload(team)) {
+		report.Problems = append(report.Problems, "the team file has unsigned changes")
+	}
+
+	return report, nil
+}
+
+func countTrustedSignatures(team *TeamFile, member *Member, trusted map[string]bool) int {
+	seen := make(map[string]bool)
+	for _, sig := range member.Signatures {
+		if seen[sig.Signer] || !trusted[sig.Signer] || sig.Signer == member.ID {
+			continue
+		}
+		signer := findMember(team, sig.Signer)
+		if signer != nil && verify(signer, sig, memberPayload(member)) {
+			seen[sig.Signer] = true
+		}
+	}
+	return len(seen)
+}
+
+// everSigned reports whether anything in the team shows it was signed before
+func (team *TeamFile) everSigned() bool {
+	if team.Revision > 0 || team.Signature != nil {
+		return true
+	}
+	for _, member := range team.Members {
+		if len(member.Signatures) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// loadPins reads the signing keys of the team roots pinned for each
+// repository, keyed by the absolute path of its .lockbox directory
+func (km *KeyManager) loadPins() (map[string]string, string, error) {
+	repo, err := filepath.Abs(km.localDir)
+	if err != nil {
+		return nil, "", err
+	}
+
+	pinsFile := filepath.Join(km.globalDir, "trusted-roots.json")
+	pins := make(map[string]string)
+	if data, err := os.ReadFile(pinsFile); err == nil {
+		if err := json.Unmarshal(data, &pins); err != nil {
+			return nil, "", fmt.Errorf("failed to parse %s: %w", pinsFile, err)
+		}
+	}
+
+	return pins, repo, nil
+}
+
+// pinnedRoot returns the signing key pinned for this repository's team root,
+// or "" if none has been pinned
+func (km *KeyManager) pinnedRoot() (string, error) {
+	pins, repo, err := km.loadPins()
+	if err != nil {
+		return "", err
+	}
+	return pins[repo], nil
+}
+
+// checkPinnedRoot compares the team root's signing key with the one seen the
+// first time this repository was used, and pins it if there is none yet
+func (km *KeyManager) checkPinnedRoot(root *Member) error {
+	if root.SigningKey == "" {
+		return fmt.Errorf("the team root %s has no signing key", root.Name)
+	}
+
+	pins, repo, err := km.loadPins()
+	if err != nil {
+		return err
+	}
+
+	if pinned, ok := pins[repo]; ok {
+		if pinned != root.SigningKey {
+			return fmt.Errorf("the team root signing key has changed since it was first trusted")
+		}
+		return nil
+	}
+
+	pins[repo] = root.SigningKey
+	data, err := json.MarshalIndent(pins, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal trusted roots: %w", err)
+	}
+	return os.WriteFile(filepath.Join(km.globalDir, "trusted-roots.json"), data, 0600)
+}
+
+// checkTrust refuses to encrypt for a signed team with untrusted members or
+// changes, or for a team whose signatures were stripped, unless that was
+// explicitly allowed. Teams that were never signed and allowed problems only
+// produce a warning, once per KeyManager.
+func (km *KeyManager) checkTrust(team *TeamFile) error {
+	report, err := km.verifyTeam(team)
+	if err != nil {
+		return err
+	}
+
+	if report.OK() {
+		return nil
+	}
+
+	if (report.Signed || report.Downgraded) && !km.allowUntrusted {
+		return fmt.Errorf("refusing to encrypt for an untrusted team:\n  - %s\nHave a team member run 'lockbox team sign', or pass --allow-untrusted",
+			strings.Join(report.Problems, "\n  - "))
+	}
+
+	if !km.trustWarned {
+		km.trustWarned = true
+		output.Warnf("Team membership cannot be verified, encrypting anyway:")
+		for _, problem := range report.Problems {
+			output.Warnf("  %s", problem)
+		}
+	}
+
+	return nil
+}
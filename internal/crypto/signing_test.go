@@ -0,0 +1,298 @@
+package crypto
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"filippo.io/age"
+)
+
+// newTestKeyManager returns a KeyManager with its own home and repository directories
+func newTestKeyManager(t *testing.T) *KeyManager {
+	t.Helper()
+	return &KeyManager{
+		globalDir: t.TempDir(),
+		localDir:  filepath.Join(t.TempDir(), ".lockbox"),
+	}
+}
+
+// otherUser returns a KeyManager for a different user of the same repository
+func otherUser(t *testing.T, km *KeyManager) *KeyManager {
+	t.Helper()
+	return &KeyManager{globalDir: t.TempDir(), localDir: km.localDir}
+}
+
+func newPublicKey(t *testing.T) string {
+	t.Helper()
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return identity.Recipient().String()
+}
+
+// newSignedTeam creates a team rooted at the user's own key "me", with bob
+// added and vouched for by me
+func newSignedTeam(t *testing.T) (*KeyManager, *Member, *Member) {
+	t.Helper()
+	km := newTestKeyManager(t)
+
+	identity, err := km.GenerateKeyPair("me")
+	if err != nil {
+		t.Fatal(err)
+	}
+	me, err := km.AddTeamMember(&Member{Name: "me", PublicKey: identity.PublicKey})
+	if err != nil {
+		t.Fatal(err)
+	}
+	bob, err := km.AddTeamMember(&Member{Name: "bob", PublicKey: newPublicKey(t)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return km, me, bob
+}
+
+func TestVerifyTeamSignedTeam(t *testing.T) {
+	km, me, bob := newSignedTeam(t)
+
+	report, err := km.VerifyTeam()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.OK() {
+		t.Fatalf("expected a trusted team, got problems %v", report.Problems)
+	}
+	if !report.Trusted[me.ID] || !report.Trusted[bob.ID] {
+		t.Errorf("expected me and bob to be trusted, got %v", report.Trusted)
+	}
+}
+
+func TestVerifyTeamUnsignedMember(t *testing.T) {
+	km, _, _ := newSignedTeam(t)
+
+	// Someone who isn't on the team can add a key, but can't sign for it
+	mallory, err := otherUser(t, km).AddTeamMember(&Member{Name: "mallory", PublicKey: newPublicKey(t)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := km.VerifyTeam()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.OK() || report.Trusted[mallory.ID] {
+		t.Fatalf("expected mallory to be untrusted, got %v", report.Trusted)
+	}
+
+	team, err := km.LoadTeam()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := km.checkTrust(team); err == nil {
+		t.Error("expected checkTrust to refuse an unsigned member")
+	}
+
+	km.SetAllowUntrusted(true)
+	if err := km.checkTrust(team); err != nil {
+		t.Errorf("expected --allow-untrusted to encrypt anyway, got %v", err)
+	}
+}
+
+func TestVerifyTeamNeverSigned(t *testing.T) {
+	km := newTestKeyManager(t)
+	if err := os.MkdirAll(km.localDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	data := []byte("# alice\n" + newPublicKey(t) + "\n")
+	if err := os.WriteFile(filepath.Join(km.localDir, legacyTeamFileName), data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := km.VerifyTeam()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Signed || report.Downgraded {
+		t.Errorf("expected a never signed team, got signed=%v downgraded=%v", report.Signed, report.Downgraded)
+	}
+
+	team, err := km.LoadTeam()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := km.checkTrust(team); err != nil {
+		t.Errorf("expected a never signed team to only warn, got %v", err)
+	}
+}
+
+func TestCheckTrustRefusesDowngrade(t *testing.T) {
+	tests := []struct {
+		name      string
+		downgrade func(t *testing.T, km *KeyManager)
+	}{
+		{
+			name: "signature stripped",
+			downgrade: func(t *testing.T, km *KeyManager) {
+				team, err := km.LoadTeam()
+				if err != nil {
+					t.Fatal(err)
+				}
+				team.Root = ""
+				team.Signature = nil
+				team.Revision = 0
+				for i := range team.Members {
+					team.Members[i].Signatures = nil
+				}
+				team.Members = append(team.Members, Member{ID: "mallory", Name: "mallory", PublicKey: newPublicKey(t)})
+				if err := km.saveTeam(team); err != nil {
+					t.Fatal(err)
+				}
+			},
+		},
+		{
+			name: "legacy team file",
+			downgrade: func(t *testing.T, km *KeyManager) {
+				if err := os.Remove(filepath.Join(km.localDir, teamFileName)); err != nil {
+					t.Fatal(err)
+				}
+				data := []byte("# mallory\n" + newPublicKey(t) + "\n")
+				if err := os.WriteFile(filepath.Join(km.localDir, legacyTeamFileName), data, 0644); err != nil {
+					t.Fatal(err)
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			km, _, _ := newSignedTeam(t)
+
+			// Verifying pins the root for this repository
+			if _, err := km.VerifyTeam(); err != nil {
+				t.Fatal(err)
+			}
+
+			tt.downgrade(t, km)
+
+			team, err := km.LoadTeam()
+			if err != nil {
+				t.Fatal(err)
+			}
+			report, err := km.verifyTeam(team)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !report.Downgraded {
+				t.Error("expected the unsigned team to be reported as downgraded")
+			}
+			if err := km.checkTrust(team); err == nil {
+				t.Error("expected checkTrust to refuse a downgraded team")
+			}
+
+			km.SetAllowUntrusted(true)
+			if err := km.checkTrust(team); err != nil {
+				t.Errorf("expected --allow-untrusted to encrypt anyway, got %v", err)
+			}
+		})
+	}
+}
+
+func TestVerifyTeamEverSignedWithoutPin(t *testing.T) {
+	km, _, _ := newSignedTeam(t)
+
+	team, err := km.LoadTeam()
+	if err != nil {
+		t.Fatal(err)
+	}
+	team.Root = ""
+	team.Signature = nil
+
+	// A user who never pinned the root still sees the leftover signatures
+	report, err := otherUser(t, km).verifyTeam(team)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.Downgraded {
+		t.Error("expected a team with leftover signatures to be reported as downgraded")
+	}
+}
+
+func TestCountTrustedSignatures(t *testing.T) {
+	km, me, bob := newSignedTeam(t)
+
+	team, err := km.LoadTeam()
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, key, err := km.signer(team)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	carol := Member{ID: "carol", Name: "carol", PublicKey: newPublicKey(t)}
+	team.Members = append(team.Members, carol)
+	member := &team.Members[len(team.Members)-1]
+	vouch(member, signer, key)
+
+	trusted := map[string]bool{me.ID: true}
+	if n := countTrustedSignatures(team, member, trusted); n != 1 {
+		t.Errorf("expected 1 trusted signature, got %d", n)
+	}
+
+	// A second copy of the same signature counts once
+	member.Signatures = append(member.Signatures, member.Signatures[0])
+	if n := countTrustedSignatures(team, member, trusted); n != 1 {
+		t.Errorf("expected a repeated signer to count once, got %d", n)
+	}
+
+	// Signatures by untrusted members don't count
+	if n := countTrustedSignatures(team, member, map[string]bool{bob.ID: true}); n != 0 {
+		t.Errorf("expected no trusted signatures, got %d", n)
+	}
+
+	// A signature stops counting once the entry it covers changes
+	member.PublicKey = newPublicKey(t)
+	if n := countTrustedSignatures(team, member, trusted); n != 0 {
+		t.Errorf("expected a signature over a changed entry not to count, got %d", n)
+	}
+
+	// Members can't vouch for themselves
+	self := findMember(team, me.ID)
+	vouch(self, signer, key)
+	if n := countTrustedSignatures(team, self, trusted); n != 0 {
+		t.Errorf("expected a self signature not to count, got %d", n)
+	}
+}
+
+func TestCheckPinnedRoot(t *testing.T) {
+	km, me, _ := newSignedTeam(t)
+
+	root := *me
+	if err := km.checkPinnedRoot(&root); err != nil {
+		t.Fatalf("expected the first root to be pinned, got %v", err)
+	}
+	if pinned, err := km.pinnedRoot(); err != nil || pinned != me.SigningKey {
+		t.Fatalf("expected %s to be pinned, got %q (%v)", me.SigningKey, pinned, err)
+	}
+	if err := km.checkPinnedRoot(&root); err != nil {
+		t.Errorf("expected the pinned root to pass, got %v", err)
+	}
+
+	other := newTestKeyManager(t)
+	other.globalDir = km.globalDir
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	root.SigningKey = encodeSigningKey(signingKeyFromPrivateKey(identity.String()))
+	if err := km.checkPinnedRoot(&root); err == nil {
+		t.Error("expected a changed root signing key to be refused")
+	}
+
+	// Pins are per repository
+	if err := other.checkPinnedRoot(&root); err != nil {
+		t.Errorf("expected a different repository to pin its own root, got %v", err)
+	}
+}
@@ -0,0 +1,123 @@
+package crypto
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"filippo.io/age"
+	"filippo.io/age/agessh"
+	"github.com/yourusername/lockbox/internal/output"
+	"golang.org/x/crypto/ssh"
+)
+
+// sshKeyFiles are the private keys in ~/.ssh that are tried as identities
+var sshKeyFiles = []string{"id_ed25519", "id_rsa"}
+
+// parseRecipient parses an age X25519 public key or an ssh-ed25519/ssh-rsa public key
+func parseRecipient(publicKey string) (age.Recipient, error) {
+	publicKey = strings.TrimSpace(publicKey)
+	if strings.HasPrefix(publicKey, "ssh-") {
+		return agessh.ParseRecipient(publicKey)
+	}
+	return age.ParseX25519Recipient(publicKey)
+}
+
+// ParseAuthorizedKeys reads an authorized_keys-style file and returns one
+// identity per key. The key comment, if any, is used as the name.
+func ParseAuthorizedKeys(data []byte) ([]Identity, error) {
+	var identities []Identity
+	for lineNum, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		pubKey, comment, _, _, err := ssh.ParseAuthorizedKey([]byte(line))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid SSH public key: %w", lineNum+1, err)
+		}
+
+		switch pubKey.Type() {
+		case "ssh-ed25519", "ssh-rsa":
+		default:
+			return nil, fmt.Errorf("line %d: unsupported SSH key type %s", lineNum+1, pubKey.Type())
+		}
+
+		identities = append(identities, Identity{
+			Name:      comment,
+			PublicKey: strings.TrimSpace(string(ssh.MarshalAuthorizedKey(pubKey))),
+		})
+	}
+
+	return identities, nil
+}
+
+// sshIdentities loads the user's SSH private keys from ~/.ssh. Encrypted keys
+// ask for their passphrase through the passphrase callback, and only when a
+// file actually contains a stanza for them. Keys that can't be read or parsed
+// are skipped with a warning, so they don't stop other identities from working.
+func (km *KeyManager) sshIdentities(d *Decryptor) []age.Identity {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return nil
+	}
+
+	var identities []age.Identity
+	for _, name := range sshKeyFiles {
+		keyPath := filepath.Join(homeDir, ".ssh", name)
+		pemBytes, err := os.ReadFile(keyPath)
+		if err != nil {
+			if !os.IsNotExist(err) {
+				output.Warnf("Skipping SSH key %s: %v", keyPath, err)
+			}
+			continue
+		}
+
+		displayName := filepath.Join("~", ".ssh", name)
+		identity, err := km.parseSSHIdentity(keyPath, displayName, pemBytes)
+		if err != nil {
+			output.Warnf("Skipping SSH key %s: %v", keyPath, err)
+			continue
+		}
+
+		identities = append(identities, &namedIdentity{name: displayName, identity: identity, d: d})
+	}
+
+	return identities
+}
+
+func (km *KeyManager) parseSSHIdentity(keyPath string, displayName string, pemBytes []byte) (age.Identity, error) {
+	identity, err := agessh.ParseIdentity(pemBytes)
+	if err == nil {
+		return identity, nil
+	}
+
+	var missing *ssh.PassphraseMissingError
+	if !errors.As(err, &missing) {
+		return nil, err
+	}
+
+	pubKey := missing.PublicKey
+	if pubKey == nil {
+		// Legacy PEM keys don't embed the public key, fall back to the .pub file
+		pubData, err := os.ReadFile(keyPath + ".pub")
+		if err != nil {
+			return nil, fmt.Errorf("encrypted key without a matching .pub file: %w", err)
+		}
+		pubKey, _, _, _, err = ssh.ParseAuthorizedKey(pubData)
+		if err != nil {
+			return nil, fmt.Errorf("invalid public key file: %w", err)
+		}
+	}
+
+	return agessh.NewEncryptedSSHIdentity(pubKey, pemBytes, func() ([]byte, error) {
+		if km.passphrase == nil {
+			return nil, fmt.Errorf("SSH key %s is passphrase-protected", displayName)
+		}
+		passphrase, err := km.passphrase(displayName)
+		return []byte(passphrase), err
+	})
+}
@@ -0,0 +1,121 @@
+package crypto
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"filippo.io/age"
+	"golang.org/x/crypto/ssh"
+)
+
+// newSSHHome points $HOME at a temporary directory with an RSA key in
+// ~/.ssh/id_rsa, returning its public key in authorized_keys format
+func newSSHHome(t *testing.T) string {
+	t.Helper()
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pemBytes := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+
+	if err := os.MkdirAll(filepath.Join(home, ".ssh"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(home, ".ssh", "id_rsa"), pemBytes, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	pubKey, err := ssh.NewPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.TrimSpace(string(ssh.MarshalAuthorizedKey(pubKey)))
+}
+
+func TestParseAuthorizedKeys(t *testing.T) {
+	publicKey := newSSHHome(t)
+
+	data := "# team keys\n\n" + publicKey + " alice@laptop\n"
+	identities, err := ParseAuthorizedKeys([]byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(identities) != 1 || identities[0].Name != "alice@laptop" || identities[0].PublicKey != publicKey {
+		t.Errorf("expected alice@laptop with %s, got %+v", publicKey, identities)
+	}
+
+	if _, err := ParseAuthorizedKeys([]byte("ssh-rsa not-base64\n")); err == nil || !strings.Contains(err.Error(), "line 1") {
+		t.Errorf("expected an error naming line 1, got %v", err)
+	}
+}
+
+func TestDecryptWithSSHKey(t *testing.T) {
+	publicKey := newSSHHome(t)
+	km := newTestKeyManager(t)
+
+	recipient, err := parseRecipient(publicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var encrypted bytes.Buffer
+	w, err := age.Encrypt(&encrypted, recipient)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write([]byte("secret"))
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	d, err := km.NewDecryptor()
+	if err != nil {
+		t.Fatal(err)
+	}
+	plaintext, err := d.Decrypt(encrypted.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(plaintext) != "secret" || d.Matched() != filepath.Join("~", ".ssh", "id_rsa") {
+		t.Errorf("expected ~/.ssh/id_rsa to decrypt \"secret\", got %q with %s", plaintext, d.Matched())
+	}
+}
+
+func TestSSHIdentitiesSkipsBadKeys(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	km := newTestKeyManager(t)
+
+	if err := os.MkdirAll(filepath.Join(home, ".ssh"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(home, ".ssh", "id_ed25519"), []byte("not a key"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if ids := km.sshIdentities(&Decryptor{km: km}); len(ids) != 0 {
+		t.Errorf("expected the unparseable key to be skipped, got %d identities", len(ids))
+	}
+
+	// With nothing else usable, NewDecryptor says so
+	if _, err := km.NewDecryptor(); err == nil || !strings.Contains(err.Error(), "no personal or SSH keys") {
+		t.Errorf("expected an error about missing keys, got %v", err)
+	}
+
+	// A personal key still works next to the broken SSH key
+	if _, err := km.GenerateKeyPair("me"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := km.NewDecryptor(); err != nil {
+		t.Errorf("expected the broken SSH key to be skipped, got %v", err)
+	}
+}
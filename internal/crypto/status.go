@@ -0,0 +1,172 @@
+package crypto
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// SecretStatus describes how a secret in the manifest compares with the
+// current team, policy and working tree
+type SecretStatus struct {
+	Entry ManifestEntry
+
+	// Stale is set when the secret's recipients differ from the members the
+	// team and policy currently select. Added and Removed name the difference.
+	Stale   bool
+	Added   []string
+	Removed []string
+
+	CiphertextMissing bool
+	PlaintextExists   bool
+	// PlaintextModified is only meaningful when PlaintextKnown is set, i.e.
+	// this user encrypted or decrypted the file before
+	PlaintextKnown    bool
+	PlaintextModified bool
+}
+
+// Status compares every secret in the manifest with the current team
+func (km *KeyManager) Status() ([]SecretStatus, error) {
+	manifest, err := km.LoadManifest()
+	if err != nil {
+		return nil, err
+	}
+
+	team, err := km.LoadTeam()
+	if err != nil {
+		return nil, err
+	}
+
+	hashes, err := km.loadPlaintextHashes()
+	if err != nil {
+		return nil, err
+	}
+
+	var statuses []SecretStatus
+	for _, entry := range manifest.Secrets {
+		status := SecretStatus{Entry: entry}
+
+		members, _, err := km.recipientsFor(team, km.AbsPath(entry.Plaintext))
+		if err != nil {
+			return nil, err
+		}
+
+		if MembersHash(members) != entry.RecipientsHash {
+			status.Stale = true
+			recorded := make(map[string]bool)
+			for _, id := range entry.Recipients {
+				recorded[id] = true
+			}
+			for _, member := range members {
+				if !recorded[member.ID] {
+					status.Added = append(status.Added, member.Name)
+				}
+				delete(recorded, member.ID)
+			}
+			for id := range recorded {
+				status.Removed = append(status.Removed, memberName(team, &entry, id))
+			}
+		}
+
+		if _, err := os.Stat(km.AbsPath(entry.Ciphertext)); os.IsNotExist(err) {
+			status.CiphertextMissing = true
+		}
+
+		// Secret stores have no plaintext file and record the ciphertext as both
+		plaintextPath := km.AbsPath(entry.Plaintext)
+		hasPlaintext := entry.Plaintext != entry.Ciphertext
+		if sum, err := hashFile(plaintextPath); hasPlaintext && err == nil {
+			status.PlaintextExists = true
+			if recorded, ok := hashes[plaintextPath]; ok {
+				status.PlaintextKnown = true
+				status.PlaintextModified = recorded != sum
+			}
+		}
+
+		statuses = append(statuses, status)
+	}
+
+	return statuses, nil
+}
+
+// memberName names a recipient of entry by their current name, or the one
+// recorded when entry was encrypted if they have left the team
+func memberName(team *TeamFile, entry *ManifestEntry, id string) string {
+	if member := findMember(team, id); member != nil {
+		return member.Name
+	}
+	return entry.RecipientName(id)
+}
+
+// recordPlaintextHash remembers the hash of a plaintext file lockbox just
+// encrypted or wrote, so Status can tell whether it changed since. Hashes are
+// kept in the user's home directory rather than the repository, since a hash
+// of a short secret can be brute-forced.
+func (km *KeyManager) recordPlaintextHash(path string, sum []byte) error {
+	if path == StdioPath {
+		return nil
+	}
+
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+
+	km.mu.Lock()
+	defer km.mu.Unlock()
+
+	hashes, err := km.loadPlaintextHashes()
+	if err != nil {
+		return err
+	}
+	hashes[absPath] = hex.EncodeToString(sum)
+
+	data, err := json.MarshalIndent(hashes, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal plaintext hashes: %w", err)
+	}
+
+	return os.WriteFile(filepath.Join(km.globalDir, "plaintext-hashes.json"), data, 0600)
+}
+
+// PlaintextHashes returns the recorded hash of every plaintext file this user
+// encrypted or decrypted, keyed by absolute path
+func (km *KeyManager) PlaintextHashes() (map[string]string, error) {
+	return km.loadPlaintextHashes()
+}
+
+func (km *KeyManager) loadPlaintextHashes() (map[string]string, error) {
+	hashes := make(map[string]string)
+	data, err := os.ReadFile(filepath.Join(km.globalDir, "plaintext-hashes.json"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return hashes, nil
+		}
+		return nil, fmt.Errorf("failed to read plaintext hashes: %w", err)
+	}
+
+	if err := json.Unmarshal(data, &hashes); err != nil {
+		return nil, fmt.Errorf("failed to parse plaintext hashes: %w", err)
+	}
+
+	return hashes, nil
+}
+
+func hashFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, f); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
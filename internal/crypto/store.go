@@ -0,0 +1,135 @@
+package crypto
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+)
+
+// DefaultEnv is the secret store used when no environment is given
+const DefaultEnv = "default"
+
+var (
+	envNamePattern   = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]*$`)
+	secretKeyPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+)
+
+// ValidateSecretKey checks that key can be used as an environment variable name
+func ValidateSecretKey(key string) error {
+	if !secretKeyPattern.MatchString(key) {
+		return fmt.Errorf("invalid key %q: use letters, digits and underscores, not starting with a digit", key)
+	}
+	return nil
+}
+
+// StorePath returns the path of the encrypted key-value store for env,
+// .lockbox/secrets/<env>.age
+func (km *KeyManager) StorePath(env string) (string, error) {
+	if km.localDir == "" {
+		return "", fmt.Errorf("no local directory set")
+	}
+	if !envNamePattern.MatchString(env) {
+		return "", fmt.Errorf("invalid environment name %q", env)
+	}
+
+	return filepath.Join(km.localDir, "secrets", env+".age"), nil
+}
+
+// LoadStore decrypts the key-value store for env with whichever of the user's
+// keys matches. A store that doesn't exist yet is empty.
+func (km *KeyManager) LoadStore(env string) (map[string]string, error) {
+	path, err := km.StorePath(env)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return make(map[string]string), nil
+		}
+		return nil, fmt.Errorf("failed to read secret store: %w", err)
+	}
+
+	d, err := km.NewDecryptor()
+	if err != nil {
+		return nil, err
+	}
+
+	plaintext, err := d.Decrypt(data)
+	if err != nil {
+		return nil, err
+	}
+
+	values := make(map[string]string)
+	if err := json.Unmarshal(plaintext, &values); err != nil {
+		return nil, fmt.Errorf("failed to parse secret store %s: %w", env, err)
+	}
+
+	return values, nil
+}
+
+// SaveStore encrypts values for the recipients of the store's path and
+// replaces the store for env. Saving an empty store removes it.
+func (km *KeyManager) SaveStore(env string, values map[string]string) error {
+	path, err := km.StorePath(env)
+	if err != nil {
+		return err
+	}
+
+	if len(values) == 0 {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove secret store: %w", err)
+		}
+		// The store may never have made it into the manifest
+		_ = km.ForgetSecret(path)
+		return nil
+	}
+
+	// Map keys are marshalled in sorted order, one per line, so the plaintext
+	// is stable between saves
+	plaintext, err := json.MarshalIndent(values, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal secret store: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create secrets directory: %w", err)
+	}
+
+	var members []Member
+	err = writeFileAtomic(path, func(w io.Writer) error {
+		members, err = km.encryptStream(w, bytes.NewReader(plaintext), path)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	return km.recordSecret(path, path, members)
+}
+
+// ListStores returns the environments that have a secret store
+func (km *KeyManager) ListStores() ([]string, error) {
+	if km.localDir == "" {
+		return nil, fmt.Errorf("no local directory set")
+	}
+
+	matches, err := filepath.Glob(filepath.Join(km.localDir, "secrets", "*.age"))
+	if err != nil {
+		return nil, err
+	}
+
+	var envs []string
+	for _, match := range matches {
+		envs = append(envs, filepath.Base(match[:len(match)-len(".age")]))
+	}
+	sort.Strings(envs)
+
+	return envs, nil
+}
@@ -0,0 +1,80 @@
+package crypto
+
+import (
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestStoreRoundTrip(t *testing.T) {
+	km, _, _ := newSignedTeam(t)
+
+	values, err := km.LoadStore("prod")
+	if err != nil || len(values) != 0 {
+		t.Fatalf("expected a missing store to be empty, got %v (%v)", values, err)
+	}
+
+	want := map[string]string{"API_KEY": "abc", "DB_URL": "postgres://db/prod"}
+	if err := km.SaveStore("prod", want); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := km.LoadStore("prod")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+
+	envs, err := km.ListStores()
+	if err != nil || !reflect.DeepEqual(envs, []string{"prod"}) {
+		t.Errorf("expected [prod], got %v (%v)", envs, err)
+	}
+
+	path, err := km.StorePath("prod")
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry, err := km.FindSecret(path)
+	if err != nil || entry == nil || entry.Plaintext != entry.Ciphertext {
+		t.Errorf("expected the store in the manifest without a plaintext file, got %+v (%v)", entry, err)
+	}
+
+	// Saving an empty store removes it and its manifest entry
+	if err := km.SaveStore("prod", map[string]string{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("expected the store to be removed, got %v", err)
+	}
+	if entry, _ := km.FindSecret(path); entry != nil {
+		t.Error("expected the store to be forgotten")
+	}
+}
+
+func TestStorePathRejectsInvalidNames(t *testing.T) {
+	km := newTestKeyManager(t)
+
+	for _, env := range []string{"", "../prod", "prod/eu", ".hidden"} {
+		if _, err := km.StorePath(env); err == nil {
+			t.Errorf("expected environment %q to be refused", env)
+		}
+	}
+	if _, err := km.StorePath("prod-eu.1"); err != nil {
+		t.Errorf("expected prod-eu.1 to be accepted, got %v", err)
+	}
+}
+
+func TestValidateSecretKey(t *testing.T) {
+	for _, key := range []string{"API_KEY", "_private", "a1"} {
+		if err := ValidateSecretKey(key); err != nil {
+			t.Errorf("expected %q to be valid, got %v", key, err)
+		}
+	}
+	for _, key := range []string{"", "1ABC", "API-KEY", "A B", "A=B"} {
+		if err := ValidateSecretKey(key); err == nil {
+			t.Errorf("expected %q to be invalid", key)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package crypto
+
+import (
+	"bytes"
+	"crypto/rand"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestEncryptFileRoundTrip(t *testing.T) {
+	km, _, _ := newSignedTeam(t)
+	root := filepath.Dir(km.localDir)
+
+	// Larger than age's 64 KiB chunks, so the payload spans several
+	data := make([]byte, 1<<20+123)
+	if _, err := rand.Read(data); err != nil {
+		t.Fatal(err)
+	}
+
+	plaintextPath := filepath.Join(root, "blob.bin")
+	ciphertextPath := plaintextPath + ".encrypted"
+	decryptedPath := filepath.Join(root, "blob.out")
+	if err := os.WriteFile(plaintextPath, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := km.EncryptFile(plaintextPath, ciphertextPath); err != nil {
+		t.Fatal(err)
+	}
+	d, err := km.NewDecryptor()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := d.DecryptFile(ciphertextPath, decryptedPath); err != nil {
+		t.Fatal(err)
+	}
+
+	decrypted, err := os.ReadFile(decryptedPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(decrypted, data) {
+		t.Error("expected the decrypted file to match the original")
+	}
+
+	hashes, err := km.PlaintextHashes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hashes[plaintextPath] == "" || hashes[plaintextPath] != hashes[decryptedPath] {
+		t.Errorf("expected matching plaintext hashes for both files, got %v", hashes)
+	}
+}
+
+func TestDecryptFileRemovesPartialOutput(t *testing.T) {
+	km, _, _ := newSignedTeam(t)
+	root := filepath.Dir(km.localDir)
+
+	data := make([]byte, 256<<10)
+	plaintextPath := filepath.Join(root, "blob.bin")
+	ciphertextPath := plaintextPath + ".encrypted"
+	if err := os.WriteFile(plaintextPath, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := km.EncryptFile(plaintextPath, ciphertextPath); err != nil {
+		t.Fatal(err)
+	}
+
+	// Cut the last chunk off, so decryption fails after writing some output
+	encrypted, err := os.ReadFile(ciphertextPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(ciphertextPath, encrypted[:len(encrypted)-1000], 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	d, err := km.NewDecryptor()
+	if err != nil {
+		t.Fatal(err)
+	}
+	outputPath := filepath.Join(root, "blob.out")
+	if err := d.DecryptFile(ciphertextPath, outputPath); err == nil {
+		t.Fatal("expected a truncated file to fail to decrypt")
+	}
+	if _, err := os.Stat(outputPath); !os.IsNotExist(err) {
+		t.Errorf("expected the partial output to be removed, got %v", err)
+	}
+}
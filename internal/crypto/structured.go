@@ -0,0 +1,560 @@
+package crypto
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+// Structured files keep their keys readable and encrypt each value on its own,
+// so diffs show which setting changed. Values are encrypted with a random data
+// key, using the value's path as additional data so they can't be moved to
+// another key. The data key is age-encrypted for the file's recipients and
+// stored in a "lockbox" section of the document, together with a MAC over
+// every value and the rest of the section that catches values being
+// reordered, removed or swapped and the section being edited.
+//
+// When a file is encrypted over an earlier version for the same recipients,
+// its data key is reused and unchanged values keep their ciphertext, so only
+// the values that changed show up in the diff. Only data keys this user
+// generated are reused: anyone who can commit could otherwise write a file
+// whose data key they know, and have every later edit sealed with it.
+
+// Format is the syntax of a structured secrets file
+type Format string
+
+const (
+	FormatYAML   Format = "yaml"
+	FormatJSON   Format = "json"
+	FormatDotenv Format = "dotenv"
+)
+
+// structuredVersion is the version of the lockbox section written by
+// encryptStructured. Version 1 sections, whose MAC only covers the values,
+// can still be decrypted.
+const (
+	structuredVersion       = "2"
+	legacyStructuredVersion = "1"
+)
+
+// metadataFields are the fields of the lockbox section, in the order they are written
+var metadataFields = []string{"version", "recipients", "encrypted_at", "data_key", "mac"}
+
+func isMetadataField(name string) bool {
+	for _, field := range metadataFields {
+		if name == field {
+			return true
+		}
+	}
+	return false
+}
+
+var encryptedValuePattern = regexp.MustCompile(`^ENC\[chacha20poly1305,data:([A-Za-z0-9+/=]*),nonce:([A-Za-z0-9+/=]+),type:([a-z]+)\]$`)
+
+// DetectFormat works out the format of a structured file from its name,
+// ignoring a trailing ".encrypted"
+func DetectFormat(path string) (Format, error) {
+	name := strings.TrimSuffix(filepath.Base(path), ".encrypted")
+
+	switch ext := strings.ToLower(filepath.Ext(name)); {
+	case ext == ".yaml" || ext == ".yml":
+		return FormatYAML, nil
+	case ext == ".json":
+		return FormatJSON, nil
+	case ext == ".env" || strings.HasPrefix(name, ".env."):
+		return FormatDotenv, nil
+	}
+
+	return "", fmt.Errorf("cannot tell the format of %s, expected a .yaml, .json or .env file", path)
+}
+
+// IsStructured reports whether the file at path is a structured file
+// encrypted by lockbox
+func IsStructured(path string) bool {
+	format, err := DetectFormat(path)
+	if err != nil {
+		return false
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return false
+	}
+
+	doc, err := parseDocument(data, format)
+	if err != nil {
+		return false
+	}
+
+	return doc.metadata()["data_key"] != ""
+}
+
+// EncryptStructuredFile encrypts every value of the YAML, JSON or dotenv file
+// at inputPath for the recipients the policy selects, leaving keys readable
+func (km *KeyManager) EncryptStructuredFile(inputPath string, outputPath string) error {
+	e, err := km.NewEncryptor()
+	if err != nil {
+		return err
+	}
+
+	return e.EncryptStructuredFile(inputPath, outputPath)
+}
+
+// EncryptStructuredFile is KeyManager.EncryptStructuredFile with e's recipients
+func (e *Encryptor) EncryptStructuredFile(inputPath string, outputPath string) error {
+	format, err := DetectFormat(inputPath)
+	if err != nil {
+		return err
+	}
+
+	data, err := os.ReadFile(inputPath)
+	if err != nil {
+		return fmt.Errorf("failed to read input file: %w", err)
+	}
+
+	var previous []byte
+	if outputPath != StdioPath {
+		previous, _ = os.ReadFile(outputPath)
+	}
+
+	encrypted, members, err := e.encryptStructured(data, format, inputPath, previous)
+	if err != nil {
+		return err
+	}
+
+	err = writeFile(outputPath, func(w io.Writer) error {
+		_, err := w.Write(encrypted)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	sum := sha256.Sum256(data)
+	if err := e.km.recordPlaintextHash(inputPath, sum[:]); err != nil {
+		return err
+	}
+
+	return e.km.recordSecret(inputPath, outputPath, members)
+}
+
+// DecryptStructuredFile decrypts a file written by EncryptStructuredFile with d
+func (km *KeyManager) DecryptStructuredFile(inputPath string, outputPath string, d *Decryptor) error {
+	format, err := DetectFormat(inputPath)
+	if err != nil {
+		return err
+	}
+
+	data, err := os.ReadFile(inputPath)
+	if err != nil {
+		return fmt.Errorf("failed to read encrypted file: %w", err)
+	}
+
+	plaintext, err := d.DecryptStructured(data, format)
+	if err != nil {
+		return err
+	}
+
+	err = writeFile(outputPath, func(w io.Writer) error {
+		_, err := w.Write(plaintext)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	sum := sha256.Sum256(plaintext)
+	return km.recordPlaintextHash(outputPath, sum[:])
+}
+
+// rekeyStructured re-encrypts a structured file in place with a fresh data key
+func (km *KeyManager) rekeyStructured(path string, d *Decryptor) error {
+	format, err := DetectFormat(path)
+	if err != nil {
+		return err
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read encrypted file: %w", err)
+	}
+
+	plaintext, err := d.DecryptStructured(data, format)
+	if err != nil {
+		return err
+	}
+
+	plaintextPath, err := km.plaintextPath(path)
+	if err != nil {
+		return err
+	}
+
+	e, err := km.NewEncryptor()
+	if err != nil {
+		return err
+	}
+
+	encrypted, members, err := e.encryptStructured(plaintext, format, plaintextPath, nil)
+	if err != nil {
+		return err
+	}
+
+	err = writeFileAtomic(path, func(w io.Writer) error {
+		_, err := w.Write(encrypted)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	return km.recordSecret("", path, members)
+}
+
+// encryptStructured encrypts every value of data for the recipients of path.
+// previous is the earlier encrypted version of the document, or nil; its data
+// key and unchanged values are reused if it can be decrypted and was encrypted
+// for the same recipients.
+func (e *Encryptor) encryptStructured(data []byte, format Format, path string, previous []byte) ([]byte, []Member, error) {
+	doc, err := parseDocument(data, format)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if key := doc.reservedKey(); key != "" {
+		if doc.metadata()["data_key"] != "" {
+			return nil, nil, fmt.Errorf("%s already has a lockbox section, is it encrypted already?", path)
+		}
+		return nil, nil, fmt.Errorf("%s: %s is reserved for the lockbox section, rename it to encrypt the file", path, key)
+	}
+
+	members, _, err := e.Recipients(path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var ids []string
+	for _, member := range members {
+		ids = append(ids, member.ID)
+	}
+
+	var prev *openedDocument
+	if previous != nil {
+		prev = e.openPrevious(previous, format, strings.Join(ids, ","))
+	}
+
+	var dataKey []byte
+	if prev != nil {
+		dataKey = prev.dataKey
+	} else {
+		dataKey = make([]byte, chacha20poly1305.KeySize)
+		if _, err := rand.Read(dataKey); err != nil {
+			return nil, nil, fmt.Errorf("failed to generate data key: %w", err)
+		}
+	}
+
+	aead, err := chacha20poly1305.New(dataKey)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	mac := hmac.New(sha256.New, dataKey)
+	for _, l := range doc.leaves() {
+		writeLeafMAC(mac, l.path, l.value, l.typ)
+
+		if prev != nil {
+			if old, ok := prev.values[string(leafAAD(l.path))]; ok && old.value == l.value && old.typ == l.typ {
+				l.set(old.encrypted, "str")
+				continue
+			}
+		}
+
+		nonce := make([]byte, aead.NonceSize())
+		if _, err := rand.Read(nonce); err != nil {
+			return nil, nil, fmt.Errorf("failed to generate nonce: %w", err)
+		}
+		sealed := aead.Seal(nil, nonce, []byte(l.value), leafAAD(l.path))
+		l.set(fmt.Sprintf("ENC[chacha20poly1305,data:%s,nonce:%s,type:%s]",
+			base64.StdEncoding.EncodeToString(sealed),
+			base64.StdEncoding.EncodeToString(nonce),
+			l.typ), "str")
+	}
+
+	var wrappedKey string
+	if prev != nil {
+		wrappedKey = prev.wrappedKey
+	} else {
+		var wrapped bytes.Buffer
+		w, _, err := e.writer(&wrapped, path, false, false)
+		if err != nil {
+			return nil, nil, err
+		}
+		if _, err := w.Write(dataKey); err != nil {
+			return nil, nil, fmt.Errorf("failed to encrypt data key: %w", err)
+		}
+		if err := w.Close(); err != nil {
+			return nil, nil, fmt.Errorf("failed to encrypt data key: %w", err)
+		}
+		wrappedKey = base64.StdEncoding.EncodeToString(wrapped.Bytes())
+		if err := e.km.recordDataKey(wrappedKey); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	meta := map[string]string{
+		"version":      structuredVersion,
+		"recipients":   strings.Join(ids, ","),
+		"encrypted_at": time.Now().UTC().Truncate(time.Second).Format(time.RFC3339),
+		"data_key":     wrappedKey,
+	}
+	writeMetadataMAC(mac, meta)
+	meta["mac"] = hex.EncodeToString(mac.Sum(nil))
+	doc.setMetadata(meta)
+
+	encrypted, err := doc.marshal()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return encrypted, members, nil
+}
+
+// DecryptStructured decrypts every value of a structured document and checks
+// its MAC, returning the document without its lockbox section
+func (d *Decryptor) DecryptStructured(data []byte, format Format) ([]byte, error) {
+	doc, err := parseDocument(data, format)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := d.openStructured(doc, format); err != nil {
+		return nil, err
+	}
+
+	doc.setMetadata(nil)
+	return doc.marshal()
+}
+
+// openedDocument is what encryptStructured needs from an earlier version of a
+// document to reuse its data key and the ciphertext of unchanged values
+type openedDocument struct {
+	dataKey    []byte
+	wrappedKey string
+	// values maps the leafAAD of each value to its plaintext and ciphertext
+	values map[string]openedValue
+}
+
+type openedValue struct {
+	value     string
+	typ       string
+	encrypted string
+}
+
+// openPrevious decrypts an earlier version of a document, returning nil if it
+// can't be decrypted, was encrypted for other recipients than ids or has a
+// data key this user didn't generate, in which case a fresh data key is used
+func (e *Encryptor) openPrevious(data []byte, format Format, ids string) *openedDocument {
+	doc, err := parseDocument(data, format)
+	if err != nil {
+		return nil
+	}
+	meta := doc.metadata()
+	if meta["version"] != structuredVersion || meta["recipients"] != ids || !e.km.generatedDataKey(meta["data_key"]) {
+		return nil
+	}
+
+	d, err := e.decryptor()
+	if err != nil {
+		return nil
+	}
+
+	opened, err := d.openStructured(doc, format)
+	if err != nil {
+		return nil
+	}
+	return opened
+}
+
+// openStructured decrypts every value of doc in place and checks its MAC
+func (d *Decryptor) openStructured(doc document, format Format) (*openedDocument, error) {
+	meta := doc.metadata()
+	if meta["data_key"] == "" {
+		return nil, fmt.Errorf("not an encrypted %s file", format)
+	}
+	if meta["version"] != structuredVersion && meta["version"] != legacyStructuredVersion {
+		return nil, fmt.Errorf("unsupported lockbox section version %q", meta["version"])
+	}
+
+	wrapped, err := base64.StdEncoding.DecodeString(meta["data_key"])
+	if err != nil {
+		return nil, fmt.Errorf("invalid data key: %w", err)
+	}
+
+	dataKey, err := d.Decrypt(wrapped)
+	if err != nil {
+		return nil, err
+	}
+
+	aead, err := chacha20poly1305.New(dataKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid data key: %w", err)
+	}
+
+	opened := &openedDocument{
+		dataKey:    dataKey,
+		wrappedKey: meta["data_key"],
+		values:     make(map[string]openedValue),
+	}
+
+	mac := hmac.New(sha256.New, dataKey)
+	for _, l := range doc.leaves() {
+		match := encryptedValuePattern.FindStringSubmatch(l.value)
+		if match == nil {
+			return nil, fmt.Errorf("%s is not encrypted, was it added after the file was encrypted?", strings.Join(l.path, "."))
+		}
+
+		sealed, err := base64.StdEncoding.DecodeString(match[1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid encrypted value at %s: %w", strings.Join(l.path, "."), err)
+		}
+		nonce, err := base64.StdEncoding.DecodeString(match[2])
+		if err != nil || len(nonce) != aead.NonceSize() {
+			return nil, fmt.Errorf("invalid nonce at %s", strings.Join(l.path, "."))
+		}
+
+		value, err := aead.Open(nil, nonce, sealed, leafAAD(l.path))
+		if err != nil {
+			return nil, fmt.Errorf("failed to decrypt %s: the value was modified or moved", strings.Join(l.path, "."))
+		}
+
+		writeLeafMAC(mac, l.path, string(value), match[3])
+		opened.values[string(leafAAD(l.path))] = openedValue{value: string(value), typ: match[3], encrypted: l.value}
+		l.set(string(value), match[3])
+	}
+
+	if meta["version"] != legacyStructuredVersion {
+		writeMetadataMAC(mac, meta)
+	}
+
+	expected, err := hex.DecodeString(meta["mac"])
+	if err != nil || !hmac.Equal(mac.Sum(nil), expected) {
+		return nil, fmt.Errorf("MAC mismatch: values or the lockbox section were changed after the file was encrypted")
+	}
+
+	return opened, nil
+}
+
+// leafAAD binds an encrypted value to its position in the document
+func leafAAD(path []string) []byte {
+	aad, _ := json.Marshal(path)
+	return aad
+}
+
+func writeLeafMAC(mac hash.Hash, path []string, value string, typ string) {
+	entry, _ := json.Marshal([]interface{}{path, typ, value})
+	mac.Write(append(entry, '\n'))
+}
+
+// writeMetadataMAC covers the lockbox section, so its version, recipients and
+// data key can't be swapped without the MAC failing. encrypted_at is left out
+// since it is informational only.
+func writeMetadataMAC(mac hash.Hash, meta map[string]string) {
+	entry, _ := json.Marshal([]string{meta["version"], meta["recipients"], meta["data_key"]})
+	mac.Write(append(entry, '\n'))
+}
+
+// leaf is a single value in a structured document
+type leaf struct {
+	path  []string
+	value string
+	typ   string
+	set   func(value string, typ string)
+}
+
+// document is a parsed structured file whose values can be rewritten in place
+type document interface {
+	// leaves returns every value outside the lockbox section in document order
+	leaves() []leaf
+	// metadata returns the lockbox section, or nil if there is none
+	metadata() map[string]string
+	// reservedKey returns the first key the lockbox section is stored under,
+	// or "" if the document has none
+	reservedKey() string
+	// setMetadata replaces the lockbox section, or removes it when meta is nil
+	setMetadata(meta map[string]string)
+	marshal() ([]byte, error)
+}
+
+func parseDocument(data []byte, format Format) (document, error) {
+	switch format {
+	case FormatYAML, FormatJSON:
+		return parseYAMLDocument(data, format == FormatJSON)
+	case FormatDotenv:
+		return parseDotenvDocument(data)
+	}
+	return nil, fmt.Errorf("unsupported format %q", format)
+}
+
+// recordDataKey remembers the hash of a wrapped data key this user generated,
+// so openPrevious only reuses data keys nobody else could have chosen
+func (km *KeyManager) recordDataKey(wrapped string) error {
+	km.mu.Lock()
+	defer km.mu.Unlock()
+
+	keys, err := km.loadDataKeys()
+	if err != nil {
+		return err
+	}
+	sum := sha256.Sum256([]byte(wrapped))
+	keys[hex.EncodeToString(sum[:])] = true
+
+	data, err := json.MarshalIndent(keys, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal data keys: %w", err)
+	}
+
+	return os.WriteFile(filepath.Join(km.globalDir, "data-keys.json"), data, 0600)
+}
+
+// generatedDataKey reports whether this user generated the wrapped data key
+func (km *KeyManager) generatedDataKey(wrapped string) bool {
+	km.mu.Lock()
+	defer km.mu.Unlock()
+
+	keys, err := km.loadDataKeys()
+	if err != nil {
+		return false
+	}
+	sum := sha256.Sum256([]byte(wrapped))
+	return keys[hex.EncodeToString(sum[:])]
+}
+
+func (km *KeyManager) loadDataKeys() (map[string]bool, error) {
+	keys := make(map[string]bool)
+	data, err := os.ReadFile(filepath.Join(km.globalDir, "data-keys.json"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return keys, nil
+		}
+		return nil, fmt.Errorf("failed to read data keys: %w", err)
+	}
+
+	if err := json.Unmarshal(data, &keys); err != nil {
+		return nil, fmt.Errorf("failed to parse data keys: %w", err)
+	}
+
+	return keys, nil
+}
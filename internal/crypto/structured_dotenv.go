@@ -0,0 +1,134 @@
+package crypto
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// dotenvMetadataPrefix marks the variables that hold the lockbox section in
+// dotenv files. Only the prefix followed by one of metadataFields is part of
+// the section, other variables starting with it are ordinary values.
+const dotenvMetadataPrefix = "lockbox_"
+
+var dotenvLinePattern = regexp.MustCompile(`^(\s*(?:export\s+)?)([A-Za-z_][A-Za-z0-9_.]*)(\s*=\s*)(.*)$`)
+
+// dotenvDocument is a dotenv file. Comments and blank lines are kept as they
+// are, and everything after the = of an assignment is treated as its value.
+type dotenvDocument struct {
+	lines []dotenvLine
+}
+
+type dotenvLine struct {
+	raw string
+	// prefix is everything up to the value, e.g. "export KEY=", and empty for
+	// lines that aren't assignments
+	prefix string
+	key    string
+	value  string
+}
+
+func parseDotenvDocument(data []byte) (*dotenvDocument, error) {
+	doc := &dotenvDocument{}
+	for i, raw := range strings.Split(string(data), "\n") {
+		trimmed := strings.TrimSpace(raw)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			doc.lines = append(doc.lines, dotenvLine{raw: raw})
+			continue
+		}
+
+		match := dotenvLinePattern.FindStringSubmatch(raw)
+		if match == nil {
+			return nil, fmt.Errorf("line %d is not a KEY=value assignment", i+1)
+		}
+		doc.lines = append(doc.lines, dotenvLine{
+			prefix: match[1] + match[2] + match[3],
+			key:    match[2],
+			value:  match[4],
+		})
+	}
+
+	return doc, nil
+}
+
+func (d *dotenvDocument) leaves() []leaf {
+	var leaves []leaf
+	for i := range d.lines {
+		line := &d.lines[i]
+		if line.prefix == "" || line.isMetadata() {
+			continue
+		}
+		leaves = append(leaves, leaf{
+			path:  []string{line.key},
+			value: line.value,
+			typ:   "str",
+			set: func(value string, typ string) {
+				line.value = value
+			},
+		})
+	}
+	return leaves
+}
+
+func (d *dotenvDocument) metadata() map[string]string {
+	var meta map[string]string
+	for _, line := range d.lines {
+		if line.isMetadata() {
+			if meta == nil {
+				meta = make(map[string]string)
+			}
+			meta[strings.TrimPrefix(line.key, dotenvMetadataPrefix)] = line.value
+		}
+	}
+	return meta
+}
+
+func (d *dotenvDocument) reservedKey() string {
+	for _, line := range d.lines {
+		if line.isMetadata() {
+			return line.key
+		}
+	}
+	return ""
+}
+
+func (l dotenvLine) isMetadata() bool {
+	return l.prefix != "" && strings.HasPrefix(l.key, dotenvMetadataPrefix) &&
+		isMetadataField(strings.TrimPrefix(l.key, dotenvMetadataPrefix))
+}
+
+func (d *dotenvDocument) setMetadata(meta map[string]string) {
+	var lines []dotenvLine
+	for _, line := range d.lines {
+		if !line.isMetadata() {
+			lines = append(lines, line)
+		}
+	}
+
+	// Keep the trailing newline at the end of the file
+	var trailing []dotenvLine
+	if n := len(lines); n > 0 && lines[n-1].prefix == "" && lines[n-1].raw == "" {
+		lines, trailing = lines[:n-1], []dotenvLine{lines[n-1]}
+	}
+
+	if meta != nil {
+		for _, field := range metadataFields {
+			key := dotenvMetadataPrefix + field
+			lines = append(lines, dotenvLine{prefix: key + "=", key: key, value: meta[field]})
+		}
+	}
+
+	d.lines = append(lines, trailing...)
+}
+
+func (d *dotenvDocument) marshal() ([]byte, error) {
+	var out []string
+	for _, line := range d.lines {
+		if line.prefix == "" {
+			out = append(out, line.raw)
+		} else {
+			out = append(out, line.prefix+line.value)
+		}
+	}
+	return []byte(strings.Join(out, "\n")), nil
+}
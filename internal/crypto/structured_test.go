@@ -0,0 +1,252 @@
+package crypto
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testDotenv = "DB_HOST=localhost\nDB_PORT=5432\nAPI_KEY=abc123\n"
+
+// encryptTestDotenv encrypts data as a dotenv file for the test team,
+// reusing what it can from previous
+func encryptTestDotenv(t *testing.T, km *KeyManager, data string, previous string) string {
+	t.Helper()
+	e, err := km.NewEncryptor()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var prev []byte
+	if previous != "" {
+		prev = []byte(previous)
+	}
+	encrypted, _, err := e.encryptStructured([]byte(data), FormatDotenv, "prod.env", prev)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(encrypted)
+}
+
+func decryptTestDotenv(t *testing.T, km *KeyManager, data string) (string, error) {
+	t.Helper()
+	d, err := km.NewDecryptor()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	plaintext, err := d.DecryptStructured([]byte(data), FormatDotenv)
+	return string(plaintext), err
+}
+
+// dotenvLines maps each key of a dotenv file to its full line
+func dotenvLines(data string) map[string]string {
+	lines := make(map[string]string)
+	for _, line := range strings.Split(data, "\n") {
+		if key, _, ok := strings.Cut(line, "="); ok {
+			lines[key] = line
+		}
+	}
+	return lines
+}
+
+func TestStructuredRoundTrip(t *testing.T) {
+	km, _, _ := newSignedTeam(t)
+
+	encrypted := encryptTestDotenv(t, km, testDotenv, "")
+	if strings.Contains(encrypted, "abc123") {
+		t.Fatalf("expected values to be encrypted, got\n%s", encrypted)
+	}
+
+	plaintext, err := decryptTestDotenv(t, km, encrypted)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plaintext != testDotenv {
+		t.Errorf("expected %q, got %q", testDotenv, plaintext)
+	}
+}
+
+func TestStructuredReusesUnchangedValues(t *testing.T) {
+	km, _, _ := newSignedTeam(t)
+
+	first := encryptTestDotenv(t, km, testDotenv, "")
+	changed := strings.Replace(testDotenv, "5432", "5433", 1)
+	second := encryptTestDotenv(t, km, changed, first)
+
+	before, after := dotenvLines(first), dotenvLines(second)
+	for _, key := range []string{"DB_HOST", "API_KEY", "lockbox_data_key", "lockbox_recipients"} {
+		if before[key] != after[key] {
+			t.Errorf("expected %s to be unchanged, got %q and %q", key, before[key], after[key])
+		}
+	}
+	for _, key := range []string{"DB_PORT", "lockbox_mac"} {
+		if before[key] == after[key] {
+			t.Errorf("expected %s to change", key)
+		}
+	}
+
+	plaintext, err := decryptTestDotenv(t, km, second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plaintext != changed {
+		t.Errorf("expected %q, got %q", changed, plaintext)
+	}
+}
+
+func TestStructuredNewRecipientsGetFreshDataKey(t *testing.T) {
+	km, _, _ := newSignedTeam(t)
+
+	first := encryptTestDotenv(t, km, testDotenv, "")
+	if _, err := km.AddTeamMember(&Member{Name: "carol", PublicKey: newPublicKey(t)}); err != nil {
+		t.Fatal(err)
+	}
+	second := encryptTestDotenv(t, km, testDotenv, first)
+
+	before, after := dotenvLines(first), dotenvLines(second)
+	for _, key := range []string{"DB_HOST", "lockbox_data_key"} {
+		if before[key] == after[key] {
+			t.Errorf("expected %s to be re-encrypted for the new team", key)
+		}
+	}
+}
+
+func TestStructuredTampering(t *testing.T) {
+	km, _, _ := newSignedTeam(t)
+	encrypted := encryptTestDotenv(t, km, testDotenv, "")
+	lines := dotenvLines(encrypted)
+
+	tests := []struct {
+		name   string
+		tamper func(string) string
+		want   string
+	}{
+		{
+			name: "value removed",
+			tamper: func(data string) string {
+				return strings.Replace(data, lines["API_KEY"]+"\n", "", 1)
+			},
+			want: "MAC mismatch",
+		},
+		{
+			name: "values reordered",
+			tamper: func(data string) string {
+				data = strings.Replace(data, lines["DB_HOST"], "SWAP", 1)
+				data = strings.Replace(data, lines["DB_PORT"], lines["DB_HOST"], 1)
+				return strings.Replace(data, "SWAP", lines["DB_PORT"], 1)
+			},
+			want: "MAC mismatch",
+		},
+		{
+			name: "values swapped between keys",
+			tamper: func(data string) string {
+				host := strings.TrimPrefix(lines["DB_HOST"], "DB_HOST=")
+				port := strings.TrimPrefix(lines["DB_PORT"], "DB_PORT=")
+				data = strings.Replace(data, lines["DB_HOST"], "DB_HOST="+port, 1)
+				return strings.Replace(data, lines["DB_PORT"], "DB_PORT="+host, 1)
+			},
+			want: "modified or moved",
+		},
+		{
+			name: "MAC replaced",
+			tamper: func(data string) string {
+				return strings.Replace(data, lines["lockbox_mac"], "lockbox_mac="+strings.Repeat("00", 32), 1)
+			},
+			want: "MAC mismatch",
+		},
+		{
+			name: "recipients changed",
+			tamper: func(data string) string {
+				return strings.Replace(data, lines["lockbox_recipients"], "lockbox_recipients=mallory", 1)
+			},
+			want: "MAC mismatch",
+		},
+		{
+			name: "data key replaced",
+			tamper: func(data string) string {
+				other := dotenvLines(encryptTestDotenv(t, km, testDotenv, ""))
+				return strings.Replace(data, lines["lockbox_data_key"], other["lockbox_data_key"], 1)
+			},
+			want: "modified or moved",
+		},
+		{
+			name: "plaintext value added",
+			tamper: func(data string) string {
+				return "EXTRA=1\n" + data
+			},
+			want: "EXTRA is not encrypted",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := decryptTestDotenv(t, km, tt.tamper(encrypted))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("expected an error containing %q, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func TestStructuredIgnoresForeignDataKey(t *testing.T) {
+	km, _, _ := newSignedTeam(t)
+
+	// Someone else, who could have chosen the data key, encrypts the file
+	first := encryptTestDotenv(t, km, testDotenv, "")
+	if err := os.Remove(filepath.Join(km.globalDir, "data-keys.json")); err != nil {
+		t.Fatal(err)
+	}
+
+	second := encryptTestDotenv(t, km, testDotenv, first)
+	before, after := dotenvLines(first), dotenvLines(second)
+	for _, key := range []string{"DB_HOST", "lockbox_data_key"} {
+		if before[key] == after[key] {
+			t.Errorf("expected %s not to reuse a data key this user didn't generate", key)
+		}
+	}
+
+	third := encryptTestDotenv(t, km, testDotenv, second)
+	if dotenvLines(third)["lockbox_data_key"] != after["lockbox_data_key"] {
+		t.Error("expected the data key this user generated to be reused")
+	}
+}
+
+func TestStructuredReservedKeys(t *testing.T) {
+	km, _, _ := newSignedTeam(t)
+	e, err := km.NewEncryptor()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Variables that only share the prefix are ordinary values
+	data := "lockbox_token=abc\nLOCKBOX_URL=https://example.com\n"
+	encrypted := encryptTestDotenv(t, km, data, "")
+	if strings.Contains(encrypted, "abc") || strings.Contains(encrypted, "example.com") {
+		t.Errorf("expected lockbox_token and LOCKBOX_URL to be encrypted, got\n%s", encrypted)
+	}
+	plaintext, err := decryptTestDotenv(t, km, encrypted)
+	if err != nil || plaintext != data {
+		t.Errorf("expected %q, got %q (%v)", data, plaintext, err)
+	}
+
+	tests := []struct {
+		name   string
+		data   string
+		format Format
+		want   string
+	}{
+		{name: "dotenv field", data: "lockbox_mac=1\n", format: FormatDotenv, want: "lockbox_mac is reserved"},
+		{name: "yaml section", data: "lockbox:\n  url: x\n", format: FormatYAML, want: "lockbox is reserved"},
+		{name: "already encrypted", data: encrypted, format: FormatDotenv, want: "is it encrypted already?"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := e.encryptStructured([]byte(tt.data), tt.format, "prod.env", nil)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("expected an error containing %q, got %v", tt.want, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,215 @@
+package crypto
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// metadataKey is the top-level key of the lockbox section in YAML and JSON files
+const metadataKey = "lockbox"
+
+// yamlDocument is a YAML or JSON file. JSON is parsed as YAML, which it is a
+// subset of, and written back out as JSON.
+type yamlDocument struct {
+	root *yaml.Node
+	json bool
+}
+
+func parseYAMLDocument(data []byte, isJSON bool) (*yamlDocument, error) {
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		if isJSON {
+			return nil, fmt.Errorf("failed to parse JSON: %w", err)
+		}
+		return nil, fmt.Errorf("failed to parse YAML: %w", err)
+	}
+
+	if root.Kind != yaml.DocumentNode || len(root.Content) != 1 || root.Content[0].Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("structured files must contain a single mapping at the top level")
+	}
+
+	return &yamlDocument{root: &root, json: isJSON}, nil
+}
+
+func (d *yamlDocument) top() *yaml.Node {
+	return d.root.Content[0]
+}
+
+func (d *yamlDocument) leaves() []leaf {
+	var leaves []leaf
+	var walk func(node *yaml.Node, path []string)
+	walk = func(node *yaml.Node, path []string) {
+		switch node.Kind {
+		case yaml.MappingNode:
+			for i := 0; i+1 < len(node.Content); i += 2 {
+				key := node.Content[i].Value
+				if node == d.top() && key == metadataKey {
+					continue
+				}
+				walk(node.Content[i+1], append(append([]string(nil), path...), key))
+			}
+		case yaml.SequenceNode:
+			for i, item := range node.Content {
+				walk(item, append(append([]string(nil), path...), strconv.Itoa(i)))
+			}
+		case yaml.ScalarNode:
+			leaves = append(leaves, leaf{
+				path:  path,
+				value: node.Value,
+				typ:   strings.TrimPrefix(node.ShortTag(), "!!"),
+				set: func(value string, typ string) {
+					node.Value = value
+					node.Tag = "!!" + typ
+					node.Style = 0
+				},
+			})
+		}
+		// Aliases point at nodes that are encrypted where they are defined
+	}
+	walk(d.top(), nil)
+
+	return leaves
+}
+
+func (d *yamlDocument) metadataIndex() int {
+	top := d.top()
+	for i := 0; i+1 < len(top.Content); i += 2 {
+		if top.Content[i].Value == metadataKey {
+			return i
+		}
+	}
+	return -1
+}
+
+func (d *yamlDocument) metadata() map[string]string {
+	i := d.metadataIndex()
+	if i < 0 {
+		return nil
+	}
+
+	meta := make(map[string]string)
+	section := d.top().Content[i+1]
+	for j := 0; j+1 < len(section.Content); j += 2 {
+		meta[section.Content[j].Value] = section.Content[j+1].Value
+	}
+	return meta
+}
+
+func (d *yamlDocument) reservedKey() string {
+	if d.metadataIndex() >= 0 {
+		return metadataKey
+	}
+	return ""
+}
+
+func (d *yamlDocument) setMetadata(meta map[string]string) {
+	top := d.top()
+	if i := d.metadataIndex(); i >= 0 {
+		top.Content = append(top.Content[:i], top.Content[i+2:]...)
+	}
+
+	if meta == nil {
+		return
+	}
+
+	section := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+	for _, field := range metadataFields {
+		section.Content = append(section.Content,
+			&yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: field},
+			&yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: meta[field]},
+		)
+	}
+	top.Content = append(top.Content,
+		&yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: metadataKey},
+		section,
+	)
+}
+
+func (d *yamlDocument) marshal() ([]byte, error) {
+	var buf bytes.Buffer
+	if d.json {
+		if err := writeJSONNode(&buf, d.top(), ""); err != nil {
+			return nil, err
+		}
+		buf.WriteByte('\n')
+		return buf.Bytes(), nil
+	}
+
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(d.root); err != nil {
+		return nil, fmt.Errorf("failed to write YAML: %w", err)
+	}
+	if err := enc.Close(); err != nil {
+		return nil, fmt.Errorf("failed to write YAML: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// writeJSONNode writes a node parsed from JSON back out as indented JSON,
+// keeping the original key order
+func writeJSONNode(buf *bytes.Buffer, node *yaml.Node, indent string) error {
+	switch node.Kind {
+	case yaml.MappingNode:
+		if len(node.Content) == 0 {
+			buf.WriteString("{}")
+			return nil
+		}
+		buf.WriteString("{\n")
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			buf.WriteString(indent + "  ")
+			writeJSONString(buf, node.Content[i].Value)
+			buf.WriteString(": ")
+			if err := writeJSONNode(buf, node.Content[i+1], indent+"  "); err != nil {
+				return err
+			}
+			if i+2 < len(node.Content) {
+				buf.WriteByte(',')
+			}
+			buf.WriteByte('\n')
+		}
+		buf.WriteString(indent + "}")
+	case yaml.SequenceNode:
+		if len(node.Content) == 0 {
+			buf.WriteString("[]")
+			return nil
+		}
+		buf.WriteString("[\n")
+		for i, item := range node.Content {
+			buf.WriteString(indent + "  ")
+			if err := writeJSONNode(buf, item, indent+"  "); err != nil {
+				return err
+			}
+			if i+1 < len(node.Content) {
+				buf.WriteByte(',')
+			}
+			buf.WriteByte('\n')
+		}
+		buf.WriteString(indent + "]")
+	case yaml.ScalarNode:
+		switch node.ShortTag() {
+		case "!!int", "!!float", "!!bool":
+			buf.WriteString(node.Value)
+		case "!!null":
+			buf.WriteString("null")
+		default:
+			writeJSONString(buf, node.Value)
+		}
+	default:
+		return fmt.Errorf("unsupported JSON value at line %d", node.Line)
+	}
+	return nil
+}
+
+func writeJSONString(buf *bytes.Buffer, s string) {
+	enc := json.NewEncoder(buf)
+	enc.SetEscapeHTML(false)
+	enc.Encode(s)
+	// Encode always appends a newline
+	buf.Truncate(buf.Len() - 1)
+}
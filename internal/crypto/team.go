@@ -0,0 +1,453 @@
+package crypto
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	// TeamFileVersion is the current version of .lockbox/team.json
+	TeamFileVersion = 2
+
+	teamFileName       = "team.json"
+	legacyTeamFileName = "team-keys.txt"
+)
+
+// TeamFile is the structured team membership file stored in .lockbox/team.json
+type TeamFile struct {
+	Version int `json:"version"`
+
+	// Revision is bumped every time the file is signed
+	Revision int `json:"revision,omitempty"`
+	// Threshold is how many trusted members must sign a new member (default 1)
+	Threshold int `json:"threshold,omitempty"`
+	// Root is the ID of the member whose signing key anchors trust in the team
+	Root string `json:"root,omitempty"`
+
+	Members []Member `json:"members"`
+	// Groups maps group names to member IDs, for use in .lockbox/policy
+	Groups map[string][]string `json:"groups,omitempty"`
+
+	Signature *Signature `json:"signature,omitempty"`
+}
+
+func (t *TeamFile) threshold() int {
+	if t.Threshold < 1 {
+		return 1
+	}
+	return t.Threshold
+}
+
+// Member is a single entry in the team file
+type Member struct {
+	ID         string      `json:"id"`
+	Name       string      `json:"name"`
+	Email      string      `json:"email,omitempty"`
+	Type       string      `json:"type"`
+	Tags       []string    `json:"tags,omitempty"`
+	PublicKey  string      `json:"public_key"`
+	SigningKey string      `json:"signing_key,omitempty"`
+	AddedBy    string      `json:"added_by,omitempty"`
+	AddedAt    *time.Time  `json:"added_at,omitempty"`
+	Signatures []Signature `json:"signatures,omitempty"`
+}
+
+// Identity returns the member as a public-only Identity
+func (m *Member) Identity() Identity {
+	return Identity{
+		Name:      m.Name,
+		PublicKey: m.PublicKey,
+	}
+}
+
+// Fingerprint returns the fingerprint of the member's public key
+func (m *Member) Fingerprint() string {
+	id := m.Identity()
+	return id.Fingerprint()
+}
+
+// HasTag reports whether the member carries the given tag
+func (m *Member) HasTag(tag string) bool {
+	for _, t := range m.Tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// KeyType returns "age", "ssh-ed25519" or "ssh-rsa" for a public key
+func KeyType(publicKey string) string {
+	if strings.HasPrefix(publicKey, "ssh-") {
+		return strings.Fields(publicKey)[0]
+	}
+	return "age"
+}
+
+// memberID derives a stable member ID from the member's public key
+func memberID(publicKey string) string {
+	sum := sha256.Sum256([]byte(publicKey))
+	return hex.EncodeToString(sum[:6])
+}
+
+// normalizePublicKey undoes line wrapping and stray whitespace from pasted keys
+func normalizePublicKey(publicKey string) string {
+	fields := strings.Fields(publicKey)
+	if len(fields) > 0 && strings.HasPrefix(fields[0], "ssh-") {
+		return strings.Join(fields, " ")
+	}
+	return strings.Join(fields, "")
+}
+
+// Team key management
+func (km *KeyManager) SaveTeamKey(identity *Identity) error {
+	_, err := km.AddTeamMember(&Member{
+		Name:      identity.Name,
+		PublicKey: identity.PublicKey,
+	})
+	return err
+}
+
+// AddTeamMember validates a new member, fills in its ID, key type and
+// provenance, and appends it to the team file. AddedBy defaults to the
+// current user when left empty.
+func (km *KeyManager) AddTeamMember(member *Member) (*Member, error) {
+	team, err := km.loadTeamForWrite()
+	if err != nil {
+		return nil, err
+	}
+
+	member.PublicKey = normalizePublicKey(member.PublicKey)
+	if _, err := parseRecipient(member.PublicKey); err != nil {
+		return nil, fmt.Errorf("invalid public key for %s: %w", member.Name, err)
+	}
+
+	for _, existing := range team.Members {
+		if existing.PublicKey == member.PublicKey {
+			return nil, fmt.Errorf("key is already on the team as %s", existing.Name)
+		}
+	}
+
+	now := time.Now().UTC().Truncate(time.Second)
+	member.ID = memberID(member.PublicKey)
+	member.Type = KeyType(member.PublicKey)
+	member.AddedAt = &now
+	if member.AddedBy == "" {
+		member.AddedBy = km.currentUser()
+	}
+
+	genesis := len(team.Members) == 0
+	team.Members = append(team.Members, *member)
+	added := &team.Members[len(team.Members)-1]
+
+	// Vouch for the new member if we are on the team. Someone adding themselves
+	// stays pending until an existing member signs them with 'team sign'.
+	signer, key, err := km.signer(team)
+	if err != nil {
+		return nil, err
+	}
+	if signer != nil {
+		if genesis {
+			team.Root = signer.ID
+		} else if signer.ID != added.ID {
+			vouch(added, signer, key)
+		}
+		signTeam(team, signer, key)
+	}
+
+	if err := km.saveTeam(team); err != nil {
+		return nil, err
+	}
+
+	return added, nil
+}
+
+func (km *KeyManager) ListTeamKeys() ([]Identity, error) {
+	members, err := km.ListTeamMembers()
+	if err != nil {
+		return nil, err
+	}
+
+	var identities []Identity
+	for _, member := range members {
+		identities = append(identities, member.Identity())
+	}
+
+	return identities, nil
+}
+
+// ListTeamMembers returns all members from team.json, or from the legacy
+// team-keys.txt when the repository hasn't been migrated yet
+func (km *KeyManager) ListTeamMembers() ([]Member, error) {
+	team, err := km.LoadTeam()
+	if err != nil {
+		return nil, err
+	}
+
+	return team.Members, nil
+}
+
+func (km *KeyManager) RemoveTeamKey(publicKey string) error {
+	team, err := km.loadTeamForWrite()
+	if err != nil {
+		return err
+	}
+
+	var members []Member
+	for _, member := range team.Members {
+		if member.PublicKey != publicKey {
+			members = append(members, member)
+		}
+	}
+
+	if len(members) == len(team.Members) {
+		return fmt.Errorf("no team member with that key")
+	}
+
+	removedRoot := team.Root == memberID(publicKey)
+	team.Members = members
+	for group := range team.Groups {
+		removeFromGroup(team, group, memberID(publicKey))
+	}
+
+	signer, key, err := km.signer(team)
+	if err != nil {
+		return err
+	}
+	if removedRoot {
+		// Trust has to be re-anchored, which other members will see as a root change
+		team.Root = ""
+		if signer != nil {
+			team.Root = signer.ID
+		}
+	}
+	if signer != nil {
+		signTeam(team, signer, key)
+	}
+
+	return km.saveTeam(team)
+}
+
+// AddToGroup adds a member to a recipient group, creating the group if needed
+func (km *KeyManager) AddToGroup(group string, memberID string) error {
+	if group == AllGroup {
+		return fmt.Errorf("%q is reserved for the whole team", AllGroup)
+	}
+
+	team, err := km.loadTeamForWrite()
+	if err != nil {
+		return err
+	}
+
+	if findMember(team, memberID) == nil {
+		return fmt.Errorf("no team member with ID %s", memberID)
+	}
+
+	for _, id := range team.Groups[group] {
+		if id == memberID {
+			return nil
+		}
+	}
+
+	if team.Groups == nil {
+		team.Groups = make(map[string][]string)
+	}
+	team.Groups[group] = append(team.Groups[group], memberID)
+
+	return km.saveSignedTeam(team)
+}
+
+// RemoveFromGroup removes a member from a recipient group. Empty groups are deleted.
+func (km *KeyManager) RemoveFromGroup(group string, memberID string) error {
+	team, err := km.loadTeamForWrite()
+	if err != nil {
+		return err
+	}
+
+	if _, ok := team.Groups[group]; !ok {
+		return fmt.Errorf("no group named %s", group)
+	}
+
+	removeFromGroup(team, group, memberID)
+	return km.saveSignedTeam(team)
+}
+
+func removeFromGroup(team *TeamFile, group string, memberID string) {
+	var ids []string
+	for _, id := range team.Groups[group] {
+		if id != memberID {
+			ids = append(ids, id)
+		}
+	}
+
+	if len(ids) == 0 {
+		delete(team.Groups, group)
+	} else {
+		team.Groups[group] = ids
+	}
+}
+
+// saveSignedTeam signs the team file if the user is a member, then saves it.
+// Changes made by non-members are saved unsigned and show up in VerifyTeam.
+func (km *KeyManager) saveSignedTeam(team *TeamFile) error {
+	signer, key, err := km.signer(team)
+	if err != nil {
+		return err
+	}
+	if signer != nil {
+		signTeam(team, signer, key)
+	}
+
+	return km.saveTeam(team)
+}
+
+// LoadTeam reads the team file. A repository that still uses the legacy
+// team-keys.txt is returned with Version 1.
+func (km *KeyManager) LoadTeam() (*TeamFile, error) {
+	if km.localDir == "" {
+		return nil, fmt.Errorf("no local directory set")
+	}
+
+	data, err := os.ReadFile(filepath.Join(km.localDir, teamFileName))
+	if err == nil {
+		var team TeamFile
+		if err := json.Unmarshal(data, &team); err != nil {
+			return nil, fmt.Errorf("failed to parse team file: %w", err)
+		}
+		if team.Version > TeamFileVersion {
+			return nil, fmt.Errorf("team file version %d is newer than this lockbox supports", team.Version)
+		}
+		return &team, nil
+	}
+	if !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read team file: %w", err)
+	}
+
+	data, err = os.ReadFile(filepath.Join(km.localDir, legacyTeamFileName))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return &TeamFile{Version: TeamFileVersion}, nil
+		}
+		return nil, fmt.Errorf("failed to read team keys file: %w", err)
+	}
+
+	return &TeamFile{Version: 1, Members: parseLegacyTeamKeys(data)}, nil
+}
+
+// loadTeamForWrite loads the team file and refuses to modify a legacy one
+func (km *KeyManager) loadTeamForWrite() (*TeamFile, error) {
+	team, err := km.LoadTeam()
+	if err != nil {
+		return nil, err
+	}
+
+	if team.Version < TeamFileVersion {
+		return nil, fmt.Errorf("this repository uses the legacy %s format. Run 'lockbox team migrate' first", legacyTeamFileName)
+	}
+
+	return team, nil
+}
+
+func (km *KeyManager) saveTeam(team *TeamFile) error {
+	if err := os.MkdirAll(km.localDir, 0755); err != nil {
+		return fmt.Errorf("failed to create lockbox directory: %w", err)
+	}
+
+	team.Version = TeamFileVersion
+	data, err := json.MarshalIndent(team, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal team file: %w", err)
+	}
+	data = append(data, '\n')
+
+	return writeFileAtomic(filepath.Join(km.localDir, teamFileName), func(w io.Writer) error {
+		_, err := w.Write(data)
+		return err
+	})
+}
+
+// MigrateTeamFile converts the legacy team-keys.txt into team.json and removes
+// the old file. It returns the number of migrated members.
+func (km *KeyManager) MigrateTeamFile() (int, error) {
+	team, err := km.LoadTeam()
+	if err != nil {
+		return 0, err
+	}
+
+	if team.Version >= TeamFileVersion {
+		return 0, fmt.Errorf("team file is already at version %d", team.Version)
+	}
+
+	if err := km.saveTeam(team); err != nil {
+		return 0, err
+	}
+
+	if err := os.Remove(filepath.Join(km.localDir, legacyTeamFileName)); err != nil {
+		return 0, fmt.Errorf("failed to remove %s: %w", legacyTeamFileName, err)
+	}
+
+	return len(team.Members), nil
+}
+
+// parseLegacyTeamKeys reads the v1 "# name" / key line format. Keys without a
+// preceding comment get a placeholder name, and a key that is repeated is
+// only kept once.
+func parseLegacyTeamKeys(data []byte) []Member {
+	var members []Member
+	seen := make(map[string]bool)
+	var currentName string
+
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if strings.HasPrefix(line, "#") {
+			currentName = strings.TrimSpace(strings.TrimPrefix(line, "#"))
+			continue
+		}
+
+		publicKey := normalizePublicKey(line)
+		if seen[publicKey] {
+			continue
+		}
+		seen[publicKey] = true
+
+		name := currentName
+		if name == "" {
+			name = "unnamed-" + memberID(publicKey)
+		}
+		currentName = ""
+
+		members = append(members, Member{
+			ID:        memberID(publicKey),
+			Name:      name,
+			Type:      KeyType(publicKey),
+			PublicKey: publicKey,
+		})
+	}
+
+	return members
+}
+
+// currentUser names whoever is running lockbox, for AddedBy fields: the
+// repository identity if there is one, otherwise the OS user
+func (km *KeyManager) currentUser() string {
+	if identity, err := km.LoadPrivateKey(); err == nil && identity != nil {
+		return identity.Name
+	}
+
+	if u, err := user.Current(); err == nil {
+		return u.Username
+	}
+
+	return ""
+}
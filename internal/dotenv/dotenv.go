@@ -0,0 +1,76 @@
+package dotenv
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var assignmentPattern = regexp.MustCompile(`^(?:export\s+)?([A-Za-z_][A-Za-z0-9_.]*)\s*=\s*(.*)$`)
+
+// Parse reads KEY=value assignments from a dotenv file. Blank lines and
+// comments are skipped, a leading "export" is allowed, and values may be
+// single quoted (taken literally), double quoted (with \n, \t, \" and \\
+// escapes) or bare, in which case a " #" starts a comment.
+func Parse(data []byte) (map[string]string, error) {
+	vars := make(map[string]string)
+	for i, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		match := assignmentPattern.FindStringSubmatch(line)
+		if match == nil {
+			return nil, fmt.Errorf("line %d is not a KEY=value assignment", i+1)
+		}
+
+		value, err := parseValue(match[2])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", i+1, err)
+		}
+		vars[match[1]] = value
+	}
+
+	return vars, nil
+}
+
+func parseValue(raw string) (string, error) {
+	switch {
+	case strings.HasPrefix(raw, "'"):
+		end := strings.Index(raw[1:], "'")
+		if end < 0 {
+			return "", fmt.Errorf("unterminated single-quoted value")
+		}
+		return raw[1 : end+1], nil
+
+	case strings.HasPrefix(raw, `"`):
+		var value strings.Builder
+		for i := 1; i < len(raw); i++ {
+			switch c := raw[i]; {
+			case c == '"':
+				return value.String(), nil
+			case c == '\\' && i+1 < len(raw):
+				i++
+				switch raw[i] {
+				case 'n':
+					value.WriteByte('\n')
+				case 't':
+					value.WriteByte('\t')
+				case 'r':
+					value.WriteByte('\r')
+				default:
+					value.WriteByte(raw[i])
+				}
+			default:
+				value.WriteByte(c)
+			}
+		}
+		return "", fmt.Errorf("unterminated double-quoted value")
+	}
+
+	if i := strings.Index(raw, " #"); i >= 0 {
+		raw = raw[:i]
+	}
+	return strings.TrimSpace(raw), nil
+}
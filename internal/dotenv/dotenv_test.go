@@ -0,0 +1,57 @@
+package dotenv
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	data := `# database
+DB_HOST=localhost
+export DB_PORT = 5432
+BARE=value # comment
+HASH=a#b
+SINGLE='literal \n $HOME'
+DOUBLE="line\nnext \"quoted\" \\ tab\t"
+EMPTY=
+dotted.key=1
+`
+	want := map[string]string{
+		"DB_HOST":    "localhost",
+		"DB_PORT":    "5432",
+		"BARE":       "value",
+		"HASH":       "a#b",
+		"SINGLE":     `literal \n $HOME`,
+		"DOUBLE":     "line\nnext \"quoted\" \\ tab\t",
+		"EMPTY":      "",
+		"dotted.key": "1",
+	}
+
+	got, err := Parse([]byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want string
+	}{
+		{name: "not an assignment", data: "A=1\njust text\n", want: "line 2 is not a KEY=value assignment"},
+		{name: "unterminated single quote", data: "A='abc\n", want: "line 1: unterminated single-quoted value"},
+		{name: "unterminated double quote", data: "A=\"abc\n", want: "line 1: unterminated double-quoted value"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse([]byte(tt.data))
+			if err == nil || err.Error() != tt.want {
+				t.Errorf("expected %q, got %v", tt.want, err)
+			}
+		})
+	}
+}
@@ -1,13 +1,73 @@
 package git
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"strings"
 )
 
-// FindRoot finds the git repository root by walking up directories
+// rootOverride replaces repository discovery when set by SetRoot
+var rootOverride string
+
+// SetRoot makes FindRoot return dir instead of discovering the repository,
+// so lockbox can be used outside git, e.g. in a deploy directory
+func SetRoot(dir string) error {
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return fmt.Errorf("invalid repository directory %s: %w", dir, err)
+	}
+
+	info, err := os.Stat(absDir)
+	if err != nil {
+		return fmt.Errorf("invalid repository directory: %w", err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("invalid repository directory: %s is not a directory", dir)
+	}
+
+	rootOverride = absDir
+	return nil
+}
+
+// FindRoot returns the top of the working tree lockbox should use. Git does
+// the discovery, so GIT_DIR, GIT_WORK_TREE, linked worktrees and submodules
+// all work. Without git installed it falls back to looking for a .git entry.
 func FindRoot() (string, error) {
+	if rootOverride != "" {
+		return rootOverride, nil
+	}
+
+	if _, err := exec.LookPath("git"); err != nil {
+		return findDotGit()
+	}
+
+	out, err := exec.Command("git", "rev-parse", "--show-toplevel").Output()
+	if err != nil {
+		// Pass on other problems, such as git refusing a repository owned by someone else
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && len(exitErr.Stderr) > 0 && !strings.Contains(string(exitErr.Stderr), "not a git repository") {
+			return "", fmt.Errorf("git: %s", strings.TrimPrefix(strings.TrimSpace(string(exitErr.Stderr)), "fatal: "))
+		}
+		return "", fmt.Errorf("not in a git repository. Use --repo or LOCKBOX_DIR to run elsewhere")
+	}
+
+	root := strings.TrimSpace(string(out))
+	if root == "" {
+		// Inside the git directory itself, or a bare repository
+		return "", fmt.Errorf("not in a git working tree. Use --repo or LOCKBOX_DIR to run elsewhere")
+	}
+
+	return filepath.Clean(filepath.FromSlash(root)), nil
+}
+
+// findDotGit walks up from the working directory to the first directory with
+// a .git entry, which is a directory in a regular checkout and a file in
+// linked worktrees and submodules
+func findDotGit() (string, error) {
 	dir, err := os.Getwd()
 	if err != nil {
 		return "", fmt.Errorf("failed to get current directory: %w", err)
@@ -20,8 +80,198 @@ func FindRoot() (string, error) {
 
 		parent := filepath.Dir(dir)
 		if parent == dir {
-			return "", fmt.Errorf("not in a git repository")
+			return "", fmt.Errorf("not in a git repository. Use --repo or LOCKBOX_DIR to run elsewhere")
 		}
 		dir = parent
 	}
-} 
\ No newline at end of file
+}
+
+// IsWorkTree reports whether root is inside a git working tree. It is false
+// for directories given with --repo that git doesn't know about.
+func IsWorkTree(root string) bool {
+	out, err := exec.Command("git", "-C", root, "rev-parse", "--is-inside-work-tree").Output()
+	return err == nil && strings.TrimSpace(string(out)) == "true"
+}
+
+// IsIgnored reports whether git ignores path in the repository at root.
+// Files that are already tracked are never reported as ignored.
+func IsIgnored(root string, path string) (bool, error) {
+	cmd := exec.Command("git", "-C", root, "check-ignore", "-q", "--", path)
+	err := cmd.Run()
+	if err == nil {
+		return true, nil
+	}
+
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() == 1 {
+		return false, nil
+	}
+
+	return false, fmt.Errorf("failed to run git check-ignore: %w", err)
+}
+
+// Dir returns the absolute path of the git directory of the repository at root
+func Dir(root string) (string, error) {
+	out, err := exec.Command("git", "-C", root, "rev-parse", "--absolute-git-dir").Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to find git directory: %w", err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// SetConfig sets a config value in the repository at root
+func SetConfig(root string, key string, value string) error {
+	if out, err := exec.Command("git", "-C", root, "config", key, value).CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to set git config %s: %s", key, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// HashObject returns the object ID git gives data as a blob, and writes the
+// blob to the object database if write is set
+func HashObject(root string, data []byte, write bool) (string, error) {
+	args := []string{"-C", root, "hash-object", "--stdin"}
+	if write {
+		args = append(args, "-w")
+	}
+
+	cmd := exec.Command("git", args...)
+	cmd.Stdin = bytes.NewReader(data)
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to run git hash-object: %w", err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// ReadBlob returns the contents of the blob with the given object ID
+func ReadBlob(root string, oid string) ([]byte, error) {
+	out, err := exec.Command("git", "-C", root, "cat-file", "blob", oid).Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read blob %s: %w", oid, err)
+	}
+	return out, nil
+}
+
+// AddAttributes appends "<pattern> <attributes>" lines to the .gitattributes
+// file at root for patterns that don't have all the attributes yet, and
+// returns the patterns it added
+func AddAttributes(root string, patterns []string, attributes ...string) ([]string, error) {
+	path := filepath.Join(root, ".gitattributes")
+	existing, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read .gitattributes: %w", err)
+	}
+
+	have := make(map[string]map[string]bool)
+	for _, line := range strings.Split(string(existing), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		if have[fields[0]] == nil {
+			have[fields[0]] = make(map[string]bool)
+		}
+		for _, field := range fields[1:] {
+			have[fields[0]][field] = true
+		}
+	}
+
+	var added []string
+	var lines strings.Builder
+	for _, pattern := range patterns {
+		complete := true
+		for _, attribute := range attributes {
+			complete = complete && have[pattern][attribute]
+		}
+		if complete {
+			continue
+		}
+
+		have[pattern] = make(map[string]bool)
+		for _, attribute := range attributes {
+			have[pattern][attribute] = true
+		}
+		added = append(added, pattern)
+		fmt.Fprintf(&lines, "%s %s\n", pattern, strings.Join(attributes, " "))
+	}
+
+	if len(added) == 0 {
+		return nil, nil
+	}
+
+	content := string(existing)
+	if content != "" && !strings.HasSuffix(content, "\n") {
+		content += "\n"
+	}
+	content += lines.String()
+
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		return nil, fmt.Errorf("failed to write .gitattributes: %w", err)
+	}
+
+	return added, nil
+}
+
+// InGitignore reports whether a .gitignore or exclude rule matches path,
+// whether or not the file is tracked
+func InGitignore(root string, path string) (bool, error) {
+	cmd := exec.Command("git", "-C", root, "check-ignore", "-q", "--no-index", "--", path)
+	err := cmd.Run()
+	if err == nil {
+		return true, nil
+	}
+
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() == 1 {
+		return false, nil
+	}
+
+	return false, fmt.Errorf("failed to run git check-ignore: %w", err)
+}
+
+// Attribute returns the value of a gitattribute for path, or "" if it is unset
+func Attribute(root string, path string, attribute string) (string, error) {
+	out, err := exec.Command("git", "-C", root, "check-attr", "-z", attribute, "--", path).Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to run git check-attr: %w", err)
+	}
+
+	// Output is path NUL attribute NUL value NUL
+	fields := strings.Split(string(out), "\x00")
+	if len(fields) < 3 || fields[2] == "unspecified" || fields[2] == "unset" {
+		return "", nil
+	}
+	return fields[2], nil
+}
+
+// StagedFiles returns the paths of files added, copied, modified or renamed in
+// the index, relative to root
+func StagedFiles(root string) ([]string, error) {
+	out, err := exec.Command("git", "-C", root, "diff", "--cached", "--name-only", "--diff-filter=ACMR", "-z").Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list staged files: %w", err)
+	}
+
+	var files []string
+	for _, file := range strings.Split(string(out), "\x00") {
+		if file != "" {
+			files = append(files, file)
+		}
+	}
+	return files, nil
+}
+
+// HooksDir returns the directory git runs hooks from, honouring core.hooksPath
+func HooksDir(root string) (string, error) {
+	out, err := exec.Command("git", "-C", root, "rev-parse", "--git-path", "hooks").Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to find hooks directory: %w", err)
+	}
+
+	dir := strings.TrimSpace(string(out))
+	if !filepath.IsAbs(dir) {
+		dir = filepath.Join(root, dir)
+	}
+	return dir, nil
+}
@@ -0,0 +1,144 @@
+package git
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestAddAttributes(t *testing.T) {
+	root := t.TempDir()
+	path := filepath.Join(root, ".gitattributes")
+	if err := os.WriteFile(path, []byte("*.png binary\nsecrets/** filter=lockbox diff=lockbox"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	added, err := AddAttributes(root, []string{"secrets/**", "*.env", "*.env"}, "filter=lockbox", "diff=lockbox")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(added, []string{"*.env"}) {
+		t.Errorf("expected only *.env to be added, got %v", added)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "*.png binary\nsecrets/** filter=lockbox diff=lockbox\n*.env filter=lockbox diff=lockbox\n"
+	if string(data) != want {
+		t.Errorf("expected %q, got %q", want, data)
+	}
+
+	// Adding them again changes nothing
+	if added, err := AddAttributes(root, []string{"*.env"}, "filter=lockbox", "diff=lockbox"); err != nil || len(added) != 0 {
+		t.Errorf("expected nothing to be added, got %v (%v)", added, err)
+	}
+}
+
+// chdir changes the working directory for the rest of the test
+func chdir(t *testing.T, dir string) {
+	t.Helper()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+}
+
+func newRepo(t *testing.T) string {
+	t.Helper()
+	root, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out, err := exec.Command("git", "-C", root, "init", "-q").CombinedOutput(); err != nil {
+		t.Fatalf("git init: %v\n%s", err, out)
+	}
+	return root
+}
+
+func TestFindRoot(t *testing.T) {
+	root := newRepo(t)
+	sub := filepath.Join(root, "config", "prod")
+	if err := os.MkdirAll(sub, 0755); err != nil {
+		t.Fatal(err)
+	}
+	chdir(t, sub)
+
+	got, err := FindRoot()
+	if err != nil || got != root {
+		t.Errorf("expected %s, got %q (%v)", root, got, err)
+	}
+	if !IsWorkTree(root) {
+		t.Error("expected the repository to be a work tree")
+	}
+
+	chdir(t, filepath.Join(root, ".git"))
+	if _, err := FindRoot(); err == nil {
+		t.Errorf("expected an error inside .git, got %v", err)
+	}
+}
+
+func TestFindRootOutsideRepository(t *testing.T) {
+	dir := t.TempDir()
+	chdir(t, dir)
+	t.Setenv("GIT_CEILING_DIRECTORIES", filepath.Dir(dir))
+
+	if _, err := FindRoot(); err == nil || !strings.Contains(err.Error(), "--repo") {
+		t.Errorf("expected an error suggesting --repo, got %v", err)
+	}
+	if IsWorkTree(dir) {
+		t.Error("expected a plain directory not to be a work tree")
+	}
+}
+
+func TestSetRoot(t *testing.T) {
+	t.Cleanup(func() { rootOverride = "" })
+	dir := t.TempDir()
+
+	if err := SetRoot(filepath.Join(dir, "missing")); err == nil {
+		t.Error("expected a missing directory to be refused")
+	}
+	file := filepath.Join(dir, "file")
+	if err := os.WriteFile(file, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := SetRoot(file); err == nil {
+		t.Error("expected a file to be refused")
+	}
+
+	if err := SetRoot(dir); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := FindRoot(); err != nil || got != dir {
+		t.Errorf("expected %s, got %q (%v)", dir, got, err)
+	}
+}
+
+func TestFindDotGit(t *testing.T) {
+	root := t.TempDir()
+	// Linked worktrees and submodules have a .git file
+	if err := os.WriteFile(filepath.Join(root, ".git"), []byte("gitdir: /elsewhere\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	sub := filepath.Join(root, "a", "b")
+	if err := os.MkdirAll(sub, 0755); err != nil {
+		t.Fatal(err)
+	}
+	chdir(t, sub)
+
+	got, err := findDotGit()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, _ := filepath.EvalSymlinks(root); got != root && got != want {
+		t.Errorf("expected %s, got %s", root, got)
+	}
+}
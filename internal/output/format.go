@@ -0,0 +1,86 @@
+package output
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"golang.org/x/term"
+	"gopkg.in/yaml.v3"
+)
+
+// Format is how commands print their results
+type Format string
+
+const (
+	FormatText Format = "text"
+	FormatJSON Format = "json"
+	FormatYAML Format = "yaml"
+)
+
+var (
+	format Format = FormatText
+
+	// data is where structured results are written
+	data io.Writer = os.Stdout
+)
+
+// SetFormat selects text, json or yaml output. In json and yaml mode messages
+// go to stderr, so stdout only carries the document.
+func SetFormat(name string) error {
+	switch f := Format(name); f {
+	case FormatText:
+		format = f
+	case FormatJSON, FormatYAML:
+		format = f
+		out = os.Stderr
+	default:
+		return fmt.Errorf("unknown output format %q, expected json, yaml or text", name)
+	}
+	return nil
+}
+
+// Structured reports whether results should be printed with Print instead of as text
+func Structured() bool {
+	return format != FormatText
+}
+
+// Print writes v as a JSON or YAML document. It must only be called when
+// Structured is true.
+func Print(v interface{}) error {
+	switch format {
+	case FormatJSON:
+		encoded, err := json.MarshalIndent(v, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to marshal output: %w", err)
+		}
+		_, err = fmt.Fprintf(data, "%s\n", encoded)
+		return err
+	case FormatYAML:
+		enc := yaml.NewEncoder(data)
+		enc.SetIndent(2)
+		if err := enc.Encode(v); err != nil {
+			return fmt.Errorf("failed to marshal output: %w", err)
+		}
+		return enc.Close()
+	default:
+		return fmt.Errorf("no structured output format selected")
+	}
+}
+
+// Printf writes plain text where messages go, so it moves to stderr along
+// with them in json and yaml mode
+func Printf(format string, a ...interface{}) {
+	fmt.Fprintf(out, format, a...)
+}
+
+// Println is like Printf for a line of text
+func Println(a ...interface{}) {
+	fmt.Fprintln(out, a...)
+}
+
+// IsTerminal reports whether stdout is a terminal rather than a file or pipe
+func IsTerminal() bool {
+	return term.IsTerminal(int(os.Stdout.Fd()))
+}
@@ -0,0 +1,79 @@
+package output
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+// captureFormat selects name and sends structured results to the returned
+// buffer, restoring the defaults when the test ends
+func captureFormat(t *testing.T, name string) *bytes.Buffer {
+	t.Helper()
+	t.Cleanup(func() {
+		format, data, out = FormatText, os.Stdout, os.Stdout
+	})
+
+	if err := SetFormat(name); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	data = &buf
+	return &buf
+}
+
+func TestPrintJSON(t *testing.T) {
+	buf := captureFormat(t, "json")
+	if !Structured() || out != os.Stderr {
+		t.Fatal("expected json output to be structured, with messages on stderr")
+	}
+
+	list := TeamList{Members: []Member{{ID: "3f2a", Name: "alice", Type: "age"}}, Problems: []string{}}
+	if err := Print(list); err != nil {
+		t.Fatal(err)
+	}
+
+	var decoded map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil {
+		t.Fatalf("expected valid JSON, got %v\n%s", err, buf)
+	}
+	if _, ok := decoded["members"]; !ok || !strings.Contains(buf.String(), `"name": "alice"`) {
+		t.Errorf("expected the snake_case schema, got\n%s", buf)
+	}
+	if decoded["problems"] == nil {
+		t.Error("expected empty lists to print as [] rather than null")
+	}
+}
+
+func TestPrintYAML(t *testing.T) {
+	buf := captureFormat(t, "yaml")
+
+	if err := Print(GroupList{Groups: []Group{{Name: "backend", Members: []Recipient{{ID: "3f2a", Name: "alice"}}}}}); err != nil {
+		t.Fatal(err)
+	}
+
+	var decoded GroupList
+	if err := yaml.Unmarshal(buf.Bytes(), &decoded); err != nil {
+		t.Fatalf("expected valid YAML, got %v\n%s", err, buf)
+	}
+	if len(decoded.Groups) != 1 || decoded.Groups[0].Members[0].Name != "alice" {
+		t.Errorf("expected backend with alice, got %+v", decoded)
+	}
+}
+
+func TestSetFormat(t *testing.T) {
+	captureFormat(t, "text")
+	if Structured() {
+		t.Error("expected text output not to be structured")
+	}
+	if err := Print(TeamList{}); err == nil {
+		t.Error("expected Print to fail in text mode")
+	}
+	if err := SetFormat("xml"); err == nil {
+		t.Error("expected an unknown format to be refused")
+	}
+}
@@ -3,8 +3,18 @@ package output
 import (
 	"fmt"
 	"github.com/fatih/color"
+	"io"
+	"os"
 )
 
+// out is where messages are written
+var out io.Writer = os.Stdout
+
+// SetOutput redirects messages, e.g. to stderr when stdout carries data
+func SetOutput(w io.Writer) {
+	out = w
+}
+
 var (
 	Success = color.New(color.FgGreen).SprintFunc()
 	Error   = color.New(color.FgRed).SprintFunc()
@@ -30,25 +40,25 @@ func InfoIcon() string {
 }
 
 func Successf(format string, a ...interface{}) {
-	fmt.Printf("%s %s\n", SuccessIcon(), fmt.Sprintf(format, a...))
+	fmt.Fprintf(out, "%s %s\n", SuccessIcon(), fmt.Sprintf(format, a...))
 }
 
 func Errorf(format string, a ...interface{}) {
-	fmt.Printf("%s %s\n", ErrorIcon(), fmt.Sprintf(format, a...))
+	fmt.Fprintf(out, "%s %s\n", ErrorIcon(), fmt.Sprintf(format, a...))
 }
 
 func Warnf(format string, a ...interface{}) {
-	fmt.Printf("%s %s\n", WarningIcon(), fmt.Sprintf(format, a...))
+	fmt.Fprintf(out, "%s %s\n", WarningIcon(), fmt.Sprintf(format, a...))
 }
 
 func Infof(format string, a ...interface{}) {
-	fmt.Printf("%s %s\n", InfoIcon(), fmt.Sprintf(format, a...))
+	fmt.Fprintf(out, "%s %s\n", InfoIcon(), fmt.Sprintf(format, a...))
 }
 
 func ListItem(text string) {
-	fmt.Printf("  %s %s\n", Info("•"), text)
+	fmt.Fprintf(out, "  %s %s\n", Info("•"), text)
 }
 
 func Section(title string) {
-	fmt.Printf("\n%s:\n", Header(title))
+	fmt.Fprintf(out, "\n%s:\n", Header(title))
 } 
\ No newline at end of file
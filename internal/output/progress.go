@@ -0,0 +1,76 @@
+package output
+
+import (
+	"fmt"
+	"io"
+	"time"
+)
+
+// Progress renders a single-line progress indicator for long-running transfers
+type Progress struct {
+	label   string
+	total   int64
+	current int64
+	last    time.Time
+}
+
+// NewProgress creates a progress indicator for a transfer of total bytes
+func NewProgress(label string, total int64) *Progress {
+	return &Progress{
+		label: label,
+		total: total,
+	}
+}
+
+// Reader wraps r so that every read advances the progress indicator
+func (p *Progress) Reader(r io.Reader) io.Reader {
+	return &progressReader{r: r, p: p}
+}
+
+// Add advances the indicator by n bytes, redrawing at most a few times per second
+func (p *Progress) Add(n int64) {
+	p.current += n
+	if time.Since(p.last) < 200*time.Millisecond {
+		return
+	}
+	p.last = time.Now()
+	p.render()
+}
+
+// Done draws the final state and ends the progress line
+func (p *Progress) Done() {
+	p.render()
+	fmt.Fprintln(out)
+}
+
+func (p *Progress) render() {
+	percent := 100
+	if p.total > 0 {
+		percent = int(p.current * 100 / p.total)
+	}
+	fmt.Fprintf(out, "\r%s %s %3d%% (%s / %s)", InfoIcon(), p.label, percent, formatBytes(p.current), formatBytes(p.total))
+}
+
+type progressReader struct {
+	r io.Reader
+	p *Progress
+}
+
+func (pr *progressReader) Read(b []byte) (int, error) {
+	n, err := pr.r.Read(b)
+	pr.p.Add(int64(n))
+	return n, err
+}
+
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
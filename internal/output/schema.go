@@ -0,0 +1,94 @@
+package output
+
+import "time"
+
+// The types below are the documents printed by --output json and yaml.
+// Fields may be added, but existing ones keep their names and meaning.
+
+// Member is a team member
+type Member struct {
+	ID          string   `json:"id" yaml:"id"`
+	Name        string   `json:"name" yaml:"name"`
+	Email       string   `json:"email,omitempty" yaml:"email,omitempty"`
+	Type        string   `json:"type" yaml:"type"`
+	Key         string   `json:"key" yaml:"key"`
+	Fingerprint string   `json:"fingerprint" yaml:"fingerprint"`
+	Tags        []string `json:"tags,omitempty" yaml:"tags,omitempty"`
+	Trusted     bool     `json:"trusted" yaml:"trusted"`
+	Verified    bool     `json:"verified" yaml:"verified"`
+}
+
+// TeamList is printed by 'team list'
+type TeamList struct {
+	Members  []Member `json:"members" yaml:"members"`
+	Problems []string `json:"problems" yaml:"problems"`
+}
+
+// Group is a recipient group and its members
+type Group struct {
+	Name    string      `json:"name" yaml:"name"`
+	Members []Recipient `json:"members" yaml:"members"`
+}
+
+// GroupList is printed by 'team group list'
+type GroupList struct {
+	Groups []Group `json:"groups" yaml:"groups"`
+}
+
+// Key is a personal or repository key. It never includes private material.
+type Key struct {
+	Name        string `json:"name" yaml:"name"`
+	Key         string `json:"key" yaml:"key"`
+	Fingerprint string `json:"fingerprint" yaml:"fingerprint"`
+	Words       string `json:"words,omitempty" yaml:"words,omitempty"`
+	Protected   bool   `json:"protected" yaml:"protected"`
+}
+
+// KeyList is printed by 'key list'
+type KeyList struct {
+	Keys []Key `json:"keys" yaml:"keys"`
+}
+
+// Recipient is someone a secret is encrypted for. ID is empty when only the
+// name and fingerprint are known, and Name is empty for removed members.
+type Recipient struct {
+	ID          string `json:"id,omitempty" yaml:"id,omitempty"`
+	Name        string `json:"name,omitempty" yaml:"name,omitempty"`
+	Fingerprint string `json:"fingerprint,omitempty" yaml:"fingerprint,omitempty"`
+}
+
+// Secret is an encrypted file. Source says where the details came from:
+// "envelope" or "manifest".
+type Secret struct {
+	Plaintext      string      `json:"plaintext,omitempty" yaml:"plaintext,omitempty"`
+	Ciphertext     string      `json:"ciphertext" yaml:"ciphertext"`
+	Recipients     []Recipient `json:"recipients" yaml:"recipients"`
+	EncryptedAt    *time.Time  `json:"encrypted_at,omitempty" yaml:"encrypted_at,omitempty"`
+	EncryptedBy    string      `json:"encrypted_by,omitempty" yaml:"encrypted_by,omitempty"`
+	TeamRevision   int         `json:"team_revision,omitempty" yaml:"team_revision,omitempty"`
+	LockboxVersion string      `json:"lockbox_version,omitempty" yaml:"lockbox_version,omitempty"`
+	Source         string      `json:"source,omitempty" yaml:"source,omitempty"`
+	Status         *Status     `json:"status,omitempty" yaml:"status,omitempty"`
+}
+
+// Status is what 'status' found out about a secret
+type Status struct {
+	Stale             bool     `json:"stale" yaml:"stale"`
+	Added             []string `json:"added,omitempty" yaml:"added,omitempty"`
+	Removed           []string `json:"removed,omitempty" yaml:"removed,omitempty"`
+	CiphertextMissing bool     `json:"ciphertext_missing" yaml:"ciphertext_missing"`
+	PlaintextModified bool     `json:"plaintext_modified" yaml:"plaintext_modified"`
+	PlaintextExposed  bool     `json:"plaintext_exposed" yaml:"plaintext_exposed"`
+}
+
+// SecretList is printed by 'status'
+type SecretList struct {
+	Secrets []Secret `json:"secrets" yaml:"secrets"`
+}
+
+// Store is printed by 'secret list'
+type Store struct {
+	Env          string   `json:"env" yaml:"env"`
+	Keys         []string `json:"keys" yaml:"keys"`
+	Environments []string `json:"environments" yaml:"environments"`
+}
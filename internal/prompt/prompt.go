@@ -1,36 +1,169 @@
 package prompt
 
 import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+
 	"github.com/AlecAivazis/survey/v2"
+	"github.com/yourusername/lockbox/internal/crypto"
+	"golang.org/x/term"
 )
 
 // SelectFromList presents a list of options to choose from using arrow keys
 func SelectFromList(message string, options []string) (string, error) {
+	if err := requireTerminal(message); err != nil {
+		return "", err
+	}
+
 	var selected string
 	prompt := &survey.Select{
 		Message: message,
 		Options: options,
 	}
-	err := survey.AskOne(prompt, &selected)
+	err := askOne(prompt, &selected)
 	return selected, err
 }
 
 // Confirm asks for confirmation with yes/no
 func Confirm(message string) (bool, error) {
+	if err := requireTerminal(message); err != nil {
+		return false, err
+	}
+
 	var confirmed bool
 	prompt := &survey.Confirm{
 		Message: message,
 	}
-	err := survey.AskOne(prompt, &confirmed)
+	err := askOne(prompt, &confirmed)
 	return confirmed, err
 }
 
 // Input asks for text input
 func Input(message string) (string, error) {
+	if err := requireTerminal(message); err != nil {
+		return "", err
+	}
+
 	var input string
 	prompt := &survey.Input{
 		Message: message,
 	}
-	err := survey.AskOne(prompt, &input)
+	err := askOne(prompt, &input)
 	return input, err
-} 
\ No newline at end of file
+}
+
+// Password asks for hidden text input
+func Password(message string) (string, error) {
+	if err := requireTerminal(message); err != nil {
+		return "", err
+	}
+
+	var input string
+	prompt := &survey.Password{
+		Message: message,
+	}
+	err := askOne(prompt, &input)
+	return input, err
+}
+
+// UnlockFileEnv names a file holding the passphrase that unlocks protected keys
+const UnlockFileEnv = "LOCKBOX_PASSPHRASE_FILE"
+
+// unlockFile is where KeyPassphrase reads the passphrase from instead of
+// asking. It is read once, since it may be stdin.
+var (
+	unlockFile       string
+	unlockOnce       sync.Once
+	unlockPassphrase string
+	unlockErr        error
+)
+
+// SetUnlockFile makes KeyPassphrase read the passphrase from path, or stdin
+// for "-", so protected keys can be used without a terminal
+func SetUnlockFile(path string) {
+	unlockFile = path
+}
+
+// KeyPassphrase asks for the passphrase of a protected personal key, or reads
+// it from the file set with SetUnlockFile
+func KeyPassphrase(keyName string) (string, error) {
+	if unlockFile != "" {
+		unlockOnce.Do(func() {
+			unlockPassphrase, unlockErr = ReadPassphraseFile(unlockFile)
+		})
+		return unlockPassphrase, unlockErr
+	}
+
+	if !IsInteractive() {
+		return "", fmt.Errorf("key '%s' is %w and stdin is not a terminal. Pass --unlock-passphrase-file or set %s", keyName, crypto.ErrKeyLocked, UnlockFileEnv)
+	}
+	return Password(fmt.Sprintf("Enter passphrase for key '%s'", keyName))
+}
+
+// NewPassphrase asks for a new passphrase twice and checks that both entries match.
+// An empty passphrase is returned as-is.
+func NewPassphrase(message string) (string, error) {
+	passphrase, err := Password(message)
+	if err != nil || passphrase == "" {
+		return passphrase, err
+	}
+
+	confirmation, err := Password("Confirm passphrase")
+	if err != nil {
+		return "", err
+	}
+
+	if passphrase != confirmation {
+		return "", fmt.Errorf("passphrases do not match")
+	}
+
+	return passphrase, nil
+}
+
+// askOne asks on stderr, so prompts don't end up in data piped from stdout
+func askOne(prompt survey.Prompt, response interface{}) error {
+	return survey.AskOne(prompt, response, survey.WithStdio(os.Stdin, os.Stderr, os.Stderr))
+}
+
+// IsInteractive reports whether stdin is a terminal a user can answer prompts on
+func IsInteractive() bool {
+	return term.IsTerminal(int(os.Stdin.Fd()))
+}
+
+// requireTerminal fails straight away when there is no terminal to prompt on,
+// instead of letting survey wait for input that never comes
+func requireTerminal(message string) error {
+	if IsInteractive() {
+		return nil
+	}
+	return fmt.Errorf("can't ask %q because stdin is not a terminal. Pass it as a flag or argument instead", strings.TrimSpace(message))
+}
+
+// ConfirmUnless asks for confirmation unless skip is set, e.g. by --yes
+func ConfirmUnless(skip bool, message string) (bool, error) {
+	if skip {
+		return true, nil
+	}
+	return Confirm(message)
+}
+
+// ReadPassphraseFile reads a passphrase from a file, or from stdin for "-".
+// A single trailing newline is dropped.
+func ReadPassphraseFile(path string) (string, error) {
+	var data []byte
+	var err error
+	if path == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(path)
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to read passphrase: %w", err)
+	}
+
+	passphrase := strings.TrimSuffix(string(data), "\n")
+	return strings.TrimSuffix(passphrase, "\r"), nil
+}
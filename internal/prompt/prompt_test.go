@@ -0,0 +1,19 @@
+package prompt
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/yourusername/lockbox/internal/crypto"
+)
+
+func TestKeyPassphraseWithoutTerminal(t *testing.T) {
+	if IsInteractive() {
+		t.Skip("stdin is a terminal")
+	}
+
+	_, err := KeyPassphrase("me")
+	if !errors.Is(err, crypto.ErrKeyLocked) {
+		t.Errorf("expected the error to wrap crypto.ErrKeyLocked, got %v", err)
+	}
+}